@@ -0,0 +1,29 @@
+// Package barrier 事务屏障
+// 1. 定义: 包装 TCC 组件 Try、Confirm、Cancel 中的业务逻辑, 由屏障统一处理 TCC 中最容易出错的几类异常
+//  1.1 幂等: 重复的 Try、Confirm、Cancel 请求只会执行一次业务逻辑
+//  1.2 空回滚: 未执行 Try 时收到 Cancel 请求, 跳过业务逻辑直接给予成功的响应
+//  1.3 防悬挂: 先 Cancel 后收到 Try 请求, 拒绝 Try 请求
+// 2. 实现方式: 以 (txID, componentID, phase) 为维度记录屏障, 屏障记录与业务逻辑原子提交
+//  2.1 SQLBarrier: 屏障记录与业务逻辑在同一个本地事务中提交
+//  2.2 RedisBarrier: 屏障的校验、屏障记录与业务脚本在同一个 lua 脚本中执行
+// 3. 使用方式: 组件开发者只需要编写业务逻辑, 并交由屏障的 Try、Confirm、Cancel 方法执行
+package barrier
+
+import "errors"
+
+// Phase 屏障记录的事务阶段
+type Phase string
+
+func (p Phase) String() string {
+	return string(p)
+}
+
+const (
+	PhaseTry     Phase = "try"
+	PhaseConfirm Phase = "confirm"
+	PhaseCancel  Phase = "cancel"
+)
+
+// ErrReject 业务逻辑返回该错误时, 屏障会回滚本地事务, 并给予拒绝(ACK 为 false)的响应而非返回错误
+// 例如 Try 阶段校验到余额不足时, 业务逻辑可以返回 ErrReject 拒绝本次 Try 请求
+var ErrReject = errors.New("barrier: rejected by business")
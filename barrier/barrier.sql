@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `tcc_barrier`
+(
+    `id`           bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+    `tx_id`        varchar(128) NOT NULL COMMENT '事务id',
+    `component_id` varchar(128) NOT NULL COMMENT '组件id',
+    `phase`        varchar(16) NOT NULL COMMENT '事务阶段 try/confirm/cancel',
+    `reason`       varchar(16) NOT NULL COMMENT '屏障记录的插入来源 try/confirm/cancel',
+    `created_at`   datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_tx_component_phase` (`tx_id`, `component_id`, `phase`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COMMENT '事务屏障记录';
@@ -0,0 +1,208 @@
+package barrier
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+)
+
+// RedisClient 执行 lua 脚本的 redis 客户端, github.com/xiaoxuxiansheng/redis_lock 中的 *Client 即满足该接口
+type RedisClient interface {
+	Eval(ctx context.Context, src string, keyCount int, keysAndArgs []interface{}) (interface{}, error)
+}
+
+// RedisReject 业务脚本返回该字符串时, 屏障不会写入屏障记录, 并给予拒绝(ACK 为 false)的响应
+// redis 不支持回滚, 因此业务脚本需要在完成所有校验之后再执行写操作
+const RedisReject = "reject"
+
+// RedisBiz 业务逻辑对应的 lua 脚本, 会与屏障的校验逻辑拼接为同一个脚本原子执行
+// 脚本中通过 KEYS、ARGV 访问自身的 Keys 和 Args, 与单独执行该脚本时的用法一致
+// 在 redis 集群模式下, Keys 需要与屏障记录的 key 位于同一个 slot 中, 可以通过 WithKeyPrefix 设置 hash tag
+type RedisBiz struct {
+	Script string
+	Keys   []string
+	Args   []interface{}
+}
+
+// RedisOptions redis 事务屏障的配置项
+type RedisOptions struct {
+	// 屏障记录 key 的前缀
+	KeyPrefix string
+	// 屏障记录的过期时间, 精度为秒, 需要长于事务可能被重试的时间, 否则会失去防悬挂的能力
+	Expire time.Duration
+}
+
+type RedisOption func(*RedisOptions)
+
+// WithKeyPrefix 设置屏障记录 key 的前缀
+func WithKeyPrefix(prefix string) RedisOption {
+	return func(o *RedisOptions) {
+		o.KeyPrefix = prefix
+	}
+}
+
+// WithExpire 设置屏障记录的过期时间
+func WithExpire(expire time.Duration) RedisOption {
+	return func(o *RedisOptions) {
+		o.Expire = expire
+	}
+}
+
+// repairRedisOptions 未设置的配置项赋值默认值
+func repairRedisOptions(o *RedisOptions) {
+	if o.KeyPrefix == "" {
+		o.KeyPrefix = "gotcc:barrier"
+	}
+	if o.Expire < time.Second {
+		o.Expire = 7 * 24 * time.Hour
+	}
+}
+
+// RedisBarrier 基于 redis lua 脚本实现的事务屏障, 每个 TCC 组件持有一个屏障实例
+// 屏障记录为一个 hash, 以 try、confirm、cancel 为 field, field 的值为记录的插入来源
+// 屏障的校验、业务脚本以及屏障记录的写入在同一个 lua 脚本中原子执行, 不依赖分布式锁
+type RedisBarrier struct {
+	client      RedisClient
+	componentID string
+	opts        *RedisOptions
+}
+
+// NewRedisBarrier 构造 redis 事务屏障, componentID 为使用该屏障的 TCC 组件 id
+func NewRedisBarrier(client RedisClient, componentID string, opts ...RedisOption) *RedisBarrier {
+	b := RedisBarrier{
+		client:      client,
+		componentID: componentID,
+		opts:        &RedisOptions{},
+	}
+	for _, opt := range opts {
+		opt(b.opts)
+	}
+	repairRedisOptions(b.opts)
+	return &b
+}
+
+// 所有屏障脚本的公共部分
+// 1. 业务脚本包装为函数 biz, 通过同名参数遮蔽全局的 KEYS、ARGV
+// 2. KEYS[1] 为屏障记录, ARGV[1] 为屏障记录的过期秒数, 其余的 KEYS、ARGV 透传给业务脚本
+// 3. runBiz 返回 nil 表示业务执行成功, 否则返回值即为屏障脚本的返回值
+const redisScriptPrelude = `
+local function biz(KEYS, ARGV)
+%s
+end
+local barrier = KEYS[1]
+local expire = tonumber(ARGV[1])
+local function runBiz()
+  local bizKeys, bizArgs = {}, {}
+  for i = 2, #KEYS do bizKeys[#bizKeys + 1] = KEYS[i] end
+  for i = 2, #ARGV do bizArgs[#bizArgs + 1] = ARGV[i] end
+  local reply = biz(bizKeys, bizArgs)
+  if reply == '` + RedisReject + `' then return 0 end
+  if type(reply) == 'table' and reply.err then return reply end
+  return nil
+end
+local function mark(phase, reason)
+  redis.call('HSET', barrier, phase, reason)
+  redis.call('EXPIRE', barrier, expire)
+end
+`
+
+// redisTryScript
+//  1. try 屏障记录已存在时, 由 try 插入则幂等响应为成功, 由 cancel 插入则拒绝(防悬挂)
+//  2. 执行业务脚本, 成功后写入 try 屏障记录
+const redisTryScript = redisScriptPrelude + `
+local reason = redis.call('HGET', barrier, 'try')
+if reason then
+  if reason == 'try' then return 1 end
+  return 0
+end
+local reply = runBiz()
+if reply then return reply end
+mark('try', 'try')
+return 1
+`
+
+// redisConfirmScript
+//  1. 未执行过 try 或者 try 被 cancel 抢占时, 拒绝本次请求
+//  2. confirm 屏障记录已存在时幂等响应为成功, cancel 屏障记录已存在时拒绝
+//  3. 执行业务脚本, 成功后写入 confirm 屏障记录
+const redisConfirmScript = redisScriptPrelude + `
+if redis.call('HGET', barrier, 'try') ~= 'try' then return 0 end
+if redis.call('HEXISTS', barrier, 'confirm') == 1 then return 1 end
+if redis.call('HEXISTS', barrier, 'cancel') == 1 then return 0 end
+local reply = runBiz()
+if reply then return reply end
+mark('confirm', 'confirm')
+return 1
+`
+
+// redisCancelScript
+//  1. cancel 屏障记录已存在时幂等响应为成功, confirm 屏障记录已存在时拒绝
+//  2. 未执行过 try 时, 以 cancel 为来源写入 try 屏障记录, 跳过业务脚本直接响应成功(空回滚、防悬挂)
+//  3. 执行业务脚本, 成功后写入 cancel 屏障记录
+const redisCancelScript = redisScriptPrelude + `
+if redis.call('HEXISTS', barrier, 'cancel') == 1 then return 1 end
+if redis.call('HEXISTS', barrier, 'confirm') == 1 then return 0 end
+if redis.call('HGET', barrier, 'try') == 'try' then
+  local reply = runBiz()
+  if reply then return reply end
+else
+  mark('try', 'cancel')
+end
+mark('cancel', 'cancel')
+return 1
+`
+
+// Try 在屏障保护下执行 try 的业务脚本, biz 为 nil 时仅执行屏障的校验
+func (b *RedisBarrier) Try(ctx context.Context, req *component.TCCReq, biz *RedisBiz) (*component.TCCResp, error) {
+	return b.eval(ctx, redisTryScript, req.TXID, biz)
+}
+
+// Confirm 在屏障保护下执行 confirm 的业务脚本, biz 为 nil 时仅执行屏障的校验
+func (b *RedisBarrier) Confirm(ctx context.Context, txID string, biz *RedisBiz) (*component.TCCResp, error) {
+	return b.eval(ctx, redisConfirmScript, txID, biz)
+}
+
+// Cancel 在屏障保护下执行 cancel 的业务脚本, biz 为 nil 时仅执行屏障的校验
+func (b *RedisBarrier) Cancel(ctx context.Context, txID string, biz *RedisBiz) (*component.TCCResp, error) {
+	return b.eval(ctx, redisCancelScript, txID, biz)
+}
+
+// BarrierKey 返回屏障记录的 key
+func (b *RedisBarrier) BarrierKey(txID string) string {
+	return fmt.Sprintf("%s:%s:%s", b.opts.KeyPrefix, b.componentID, txID)
+}
+
+func (b *RedisBarrier) eval(ctx context.Context, script, txID string, biz *RedisBiz) (*component.TCCResp, error) {
+	if biz == nil {
+		biz = &RedisBiz{}
+	}
+
+	// 1. 拼接屏障脚本以及业务脚本
+	src := fmt.Sprintf(script, biz.Script)
+
+	// 2. 屏障记录位于 KEYS[1] 和 ARGV[1], 业务脚本的参数依次排在其后
+	keysAndArgs := make([]interface{}, 0, 2+len(biz.Keys)+len(biz.Args))
+	keysAndArgs = append(keysAndArgs, b.BarrierKey(txID))
+	for _, key := range biz.Keys {
+		keysAndArgs = append(keysAndArgs, key)
+	}
+	keysAndArgs = append(keysAndArgs, int64(b.opts.Expire/time.Second))
+	keysAndArgs = append(keysAndArgs, biz.Args...)
+
+	reply, err := b.client.Eval(ctx, src, 1+len(biz.Keys), keysAndArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	ack, ok := reply.(int64)
+	if !ok {
+		return nil, fmt.Errorf("unexpected barrier reply: %v, txid: %s", reply, txID)
+	}
+	return &component.TCCResp{
+		ComponentID: b.componentID,
+		TXID:        txID,
+		ACK:         ack == 1,
+	}, nil
+}
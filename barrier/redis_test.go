@@ -0,0 +1,133 @@
+package barrier
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+	"github.com/xiaoxuxiansheng/gotcc/component"
+	"github.com/xiaoxuxiansheng/gotcc/component/componenttest"
+)
+
+// redigoClient 基于 redigo 实现的 RedisClient
+type redigoClient struct {
+	pool *redis.Pool
+}
+
+func newRedigoClient(t *testing.T) (*redigoClient, *miniredis.Miniredis) {
+	s := miniredis.RunT(t)
+	return &redigoClient{
+		pool: &redis.Pool{
+			Dial: func() (redis.Conn, error) {
+				return redis.Dial("tcp", s.Addr())
+			},
+		},
+	}, s
+}
+
+func (r *redigoClient) Eval(ctx context.Context, src string, keyCount int, keysAndArgs []interface{}) (interface{}, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	args := append([]interface{}{src, keyCount}, keysAndArgs...)
+	return conn.Do("EVAL", args...)
+}
+
+func Test_RedisBarrier_ComponentSuite(t *testing.T) {
+	client, _ := newRedigoClient(t)
+	componenttest.RunTCCComponentSuite(t, func() component.TCCComponent {
+		return &redisBarrierComponent{barrier: NewRedisBarrier(client, "barrier")}
+	}, nil)
+}
+
+// redisBarrierComponent 仅由屏障保护、不包含业务脚本的 TCC 组件
+type redisBarrierComponent struct {
+	barrier *RedisBarrier
+}
+
+func (r *redisBarrierComponent) ID() string {
+	return "barrier"
+}
+
+func (r *redisBarrierComponent) Try(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+	return r.barrier.Try(ctx, req, nil)
+}
+
+func (r *redisBarrierComponent) Confirm(ctx context.Context, txID string) (*component.TCCResp, error) {
+	return r.barrier.Confirm(ctx, txID, nil)
+}
+
+func (r *redisBarrierComponent) Cancel(ctx context.Context, txID string) (*component.TCCResp, error) {
+	return r.barrier.Cancel(ctx, txID, nil)
+}
+
+// 冻结库存的业务脚本, 库存不足时拒绝
+const freezeScript = `
+local stock = tonumber(redis.call('GET', KEYS[1]) or '0')
+if stock < tonumber(ARGV[1]) then return 'reject' end
+redis.call('DECRBY', KEYS[1], ARGV[1])
+redis.call('INCRBY', KEYS[2], ARGV[1])
+`
+
+// 解冻库存的业务脚本
+const unfreezeScript = `
+redis.call('INCRBY', KEYS[1], ARGV[1])
+redis.call('DECRBY', KEYS[2], ARGV[1])
+`
+
+func Test_RedisBarrier_BizScript(t *testing.T) {
+	ctx := context.Background()
+	client, s := newRedigoClient(t)
+	b := NewRedisBarrier(client, "stock")
+	if err := s.Set("stock", "10"); err != nil {
+		t.Fatal(err)
+	}
+
+	freeze := &RedisBiz{Script: freezeScript, Keys: []string{"stock", "frozen"}, Args: []interface{}{4}}
+	unfreeze := &RedisBiz{Script: unfreezeScript, Keys: []string{"stock", "frozen"}, Args: []interface{}{4}}
+
+	// 1. 重复的 try 只冻结一次库存
+	for i := 0; i < 2; i++ {
+		if resp, err := b.Try(ctx, &component.TCCReq{TXID: "1"}, freeze); err != nil || !resp.ACK {
+			t.Fatalf("try %d not accepted, resp: %+v, err: %v", i+1, resp, err)
+		}
+	}
+	s.CheckGet(t, "stock", "6")
+	s.CheckGet(t, "frozen", "4")
+
+	// 2. 重复的 cancel 只解冻一次库存
+	for i := 0; i < 2; i++ {
+		if resp, err := b.Cancel(ctx, "1", unfreeze); err != nil || !resp.ACK {
+			t.Fatalf("cancel %d not accepted, resp: %+v, err: %v", i+1, resp, err)
+		}
+	}
+	s.CheckGet(t, "stock", "10")
+	s.CheckGet(t, "frozen", "0")
+
+	// 3. 空回滚不执行业务脚本, 且之后的 try 被拒绝
+	if resp, err := b.Cancel(ctx, "2", unfreeze); err != nil || !resp.ACK {
+		t.Fatalf("empty rollback not accepted, resp: %+v, err: %v", resp, err)
+	}
+	if resp, err := b.Try(ctx, &component.TCCReq{TXID: "2"}, freeze); err != nil || resp.ACK {
+		t.Fatalf("try after cancel, resp: %+v, err: %v, expected nack", resp, err)
+	}
+	s.CheckGet(t, "stock", "10")
+
+	// 4. 业务脚本拒绝时不写入屏障记录
+	big := &RedisBiz{Script: freezeScript, Keys: []string{"stock", "frozen"}, Args: []interface{}{11}}
+	if resp, err := b.Try(ctx, &component.TCCReq{TXID: "3"}, big); err != nil || resp.ACK {
+		t.Fatalf("try with insufficient stock, resp: %+v, err: %v, expected nack", resp, err)
+	}
+	if s.Exists(b.BarrierKey("3")) {
+		t.Errorf("barrier of rejected try persisted")
+	}
+
+	// 5. 屏障记录设置了过期时间
+	if ttl := s.TTL(b.BarrierKey("1")); ttl <= 0 {
+		t.Errorf("barrier ttl: %v, expected positive", ttl)
+	}
+}
@@ -0,0 +1,243 @@
+package barrier
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+)
+
+// Dialect SQL 方言, 用于适配不同数据库的插入忽略语法以及占位符
+type Dialect string
+
+const (
+	DialectMySQL    Dialect = "mysql"
+	DialectPostgres Dialect = "postgres"
+)
+
+// insertIgnoreSQL 插入屏障记录, 记录已存在时忽略
+func (d Dialect) insertIgnoreSQL(table string) string {
+	if d == DialectPostgres {
+		return fmt.Sprintf("insert into %s (tx_id, component_id, phase, reason) values ($1, $2, $3, $4) on conflict do nothing", table)
+	}
+	return fmt.Sprintf("insert ignore into %s (tx_id, component_id, phase, reason) values (?, ?, ?, ?)", table)
+}
+
+// selectReasonSQL 查询屏障记录的插入来源, forUpdate 为 true 时对记录加写锁
+func (d Dialect) selectReasonSQL(table string, forUpdate bool) string {
+	query := fmt.Sprintf("select reason from %s where tx_id = ? and component_id = ? and phase = ?", table)
+	if d == DialectPostgres {
+		query = fmt.Sprintf("select reason from %s where tx_id = $1 and component_id = $2 and phase = $3", table)
+	}
+	if forUpdate {
+		query += " for update"
+	}
+	return query
+}
+
+// SQLOptions SQL 事务屏障的配置项
+type SQLOptions struct {
+	// 屏障表名
+	TableName string
+	// SQL 方言
+	Dialect Dialect
+}
+
+type SQLOption func(*SQLOptions)
+
+// WithTableName 设置屏障表名
+func WithTableName(tableName string) SQLOption {
+	return func(o *SQLOptions) {
+		o.TableName = tableName
+	}
+}
+
+// WithDialect 设置 SQL 方言
+func WithDialect(dialect Dialect) SQLOption {
+	return func(o *SQLOptions) {
+		o.Dialect = dialect
+	}
+}
+
+// repairSQLOptions 未设置的配置项赋值默认值
+func repairSQLOptions(o *SQLOptions) {
+	if o.TableName == "" {
+		o.TableName = "tcc_barrier"
+	}
+	if o.Dialect == "" {
+		o.Dialect = DialectMySQL
+	}
+}
+
+// BizFunc 业务逻辑, 与屏障记录在同一个本地事务 tx 中执行
+type BizFunc func(ctx context.Context, tx *sql.Tx) error
+
+// SQLBarrier 基于 database/sql 实现的事务屏障, 每个 TCC 组件持有一个屏障实例
+// 屏障表的建表语句见 barrier.sql, 需要在 (tx_id, component_id, phase) 上建立唯一索引
+type SQLBarrier struct {
+	db          *sql.DB
+	componentID string
+	opts        *SQLOptions
+}
+
+// NewSQLBarrier 构造 SQL 事务屏障, componentID 为使用该屏障的 TCC 组件 id
+func NewSQLBarrier(db *sql.DB, componentID string, opts ...SQLOption) *SQLBarrier {
+	b := SQLBarrier{
+		db:          db,
+		componentID: componentID,
+		opts:        &SQLOptions{},
+	}
+	for _, opt := range opts {
+		opt(b.opts)
+	}
+	repairSQLOptions(b.opts)
+	return &b
+}
+
+// Try 在屏障保护下执行 try 的业务逻辑
+//  1. 插入 try 屏障记录, 插入成功才会执行业务逻辑
+//  2. try 屏障记录已存在时:
+//     2.1 记录由 cancel 插入, 说明先 cancel 后 try, 拒绝本次请求(防悬挂)
+//     2.2 记录由 try 插入, 说明此前的 try 已经执行成功, 幂等响应为成功
+func (b *SQLBarrier) Try(ctx context.Context, req *component.TCCReq, biz BizFunc) (*component.TCCResp, error) {
+	return b.do(ctx, req.TXID, func(tx *sql.Tx) (bool, error) {
+		inserted, err := b.insert(ctx, tx, req.TXID, PhaseTry, PhaseTry)
+		if err != nil {
+			return false, err
+		}
+		if !inserted {
+			reason, err := b.reason(ctx, tx, req.TXID, PhaseTry, false)
+			if err != nil {
+				return false, err
+			}
+			return reason == PhaseTry, nil
+		}
+		return true, biz(ctx, tx)
+	})
+}
+
+// Confirm 在屏障保护下执行 confirm 的业务逻辑
+//  1. 对 try 屏障记录加锁, 与并发的 cancel 请求互斥
+//  2. 未执行过 try 或者 try 被 cancel 抢占时, 拒绝本次请求
+//  3. 插入 confirm 屏障记录, 记录已存在时幂等响应为成功
+//  4. 已经执行过 cancel 时, 拒绝本次请求
+func (b *SQLBarrier) Confirm(ctx context.Context, txID string, biz BizFunc) (*component.TCCResp, error) {
+	return b.do(ctx, txID, func(tx *sql.Tx) (bool, error) {
+		reason, err := b.reason(ctx, tx, txID, PhaseTry, true)
+		if err != nil {
+			return false, err
+		}
+		if reason != PhaseTry {
+			return false, nil
+		}
+
+		inserted, err := b.insert(ctx, tx, txID, PhaseConfirm, PhaseConfirm)
+		if err != nil || !inserted {
+			return err == nil, err
+		}
+
+		canceled, err := b.reason(ctx, tx, txID, PhaseCancel, false)
+		if err != nil {
+			return false, err
+		}
+		if canceled != "" {
+			return false, nil
+		}
+		return true, biz(ctx, tx)
+	})
+}
+
+// Cancel 在屏障保护下执行 cancel 的业务逻辑
+//  1. 以 cancel 为来源插入 try 屏障记录, 后续到达的 try 请求会因此被拒绝(防悬挂)
+//  2. 对 try 屏障记录加锁, 与并发的 confirm 请求互斥
+//  3. 插入 cancel 屏障记录, 记录已存在时幂等响应为成功
+//  4. 已经执行过 confirm 时, 拒绝本次请求
+//  5. try 屏障记录由 cancel 插入, 说明 try 从未执行, 跳过业务逻辑直接响应成功(空回滚)
+func (b *SQLBarrier) Cancel(ctx context.Context, txID string, biz BizFunc) (*component.TCCResp, error) {
+	return b.do(ctx, txID, func(tx *sql.Tx) (bool, error) {
+		if _, err := b.insert(ctx, tx, txID, PhaseTry, PhaseCancel); err != nil {
+			return false, err
+		}
+		reason, err := b.reason(ctx, tx, txID, PhaseTry, true)
+		if err != nil {
+			return false, err
+		}
+
+		inserted, err := b.insert(ctx, tx, txID, PhaseCancel, PhaseCancel)
+		if err != nil || !inserted {
+			return err == nil, err
+		}
+
+		confirmed, err := b.reason(ctx, tx, txID, PhaseConfirm, false)
+		if err != nil {
+			return false, err
+		}
+		if confirmed != "" {
+			return false, nil
+		}
+		if reason == PhaseCancel {
+			return true, nil
+		}
+		return true, biz(ctx, tx)
+	})
+}
+
+// do 开启本地事务执行 fn, fn 返回的 ack 为 false 或者返回错误时回滚本地事务
+func (b *SQLBarrier) do(ctx context.Context, txID string, fn func(tx *sql.Tx) (bool, error)) (*component.TCCResp, error) {
+	resp := component.TCCResp{
+		ComponentID: b.componentID,
+		TXID:        txID,
+	}
+
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ack, err := fn(tx)
+	// 1. 业务逻辑主动拒绝, 回滚后给予拒绝的响应
+	if errors.Is(err, ErrReject) {
+		_ = tx.Rollback()
+		return &resp, nil
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	// 2. 屏障拒绝, 本地事务中没有需要保留的写入
+	if !ack {
+		_ = tx.Rollback()
+		return &resp, nil
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	resp.ACK = true
+	return &resp, nil
+}
+
+// insert 插入屏障记录, 返回是否插入成功
+func (b *SQLBarrier) insert(ctx context.Context, tx *sql.Tx, txID string, phase, reason Phase) (bool, error) {
+	res, err := tx.ExecContext(ctx, b.opts.Dialect.insertIgnoreSQL(b.opts.TableName), txID, b.componentID, phase.String(), reason.String())
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// reason 查询屏障记录的插入来源, 记录不存在时返回空
+func (b *SQLBarrier) reason(ctx context.Context, tx *sql.Tx, txID string, phase Phase, forUpdate bool) (Phase, error) {
+	var reason string
+	err := tx.QueryRowContext(ctx, b.opts.Dialect.selectReasonSQL(b.opts.TableName, forUpdate), txID, b.componentID, phase.String()).Scan(&reason)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return Phase(reason), err
+}
@@ -0,0 +1,228 @@
+package barrier
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+	"github.com/xiaoxuxiansheng/gotcc/component/componenttest"
+)
+
+// memStore 基于内存模拟的屏障表, 仅支持 SQLBarrier 使用到的插入忽略以及查询语句
+// 本地事务之间通过互斥锁串行执行, 用于模拟 select for update 的加锁效果
+type memStore struct {
+	txMux sync.Mutex
+	rows  map[string]string
+}
+
+func newMemStore() *memStore {
+	return &memStore{rows: make(map[string]string)}
+}
+
+func (m *memStore) Connect(ctx context.Context) (driver.Conn, error) {
+	return &memConn{store: m}, nil
+}
+
+func (m *memStore) Driver() driver.Driver {
+	return nil
+}
+
+type memConn struct {
+	store   *memStore
+	pending map[string]string
+}
+
+func (c *memConn) Prepare(query string) (driver.Stmt, error) {
+	return &memStmt{conn: c, query: query}, nil
+}
+
+func (c *memConn) Close() error {
+	return nil
+}
+
+func (c *memConn) Begin() (driver.Tx, error) {
+	c.store.txMux.Lock()
+	c.pending = make(map[string]string)
+	return c, nil
+}
+
+func (c *memConn) Commit() error {
+	for key, reason := range c.pending {
+		c.store.rows[key] = reason
+	}
+	c.pending = nil
+	c.store.txMux.Unlock()
+	return nil
+}
+
+func (c *memConn) Rollback() error {
+	c.pending = nil
+	c.store.txMux.Unlock()
+	return nil
+}
+
+func (c *memConn) get(key string) (string, bool) {
+	if reason, ok := c.pending[key]; ok {
+		return reason, true
+	}
+	reason, ok := c.store.rows[key]
+	return reason, ok
+}
+
+type memStmt struct {
+	conn  *memConn
+	query string
+}
+
+func (s *memStmt) Close() error {
+	return nil
+}
+
+func (s *memStmt) NumInput() int {
+	return -1
+}
+
+func (s *memStmt) key(args []driver.Value) string {
+	return strings.Join([]string{args[0].(string), args[1].(string), args[2].(string)}, "|")
+}
+
+func (s *memStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if !strings.HasPrefix(s.query, "insert") {
+		return nil, errors.New("unsupported query: " + s.query)
+	}
+	key := s.key(args)
+	if _, ok := s.conn.get(key); ok {
+		return driver.RowsAffected(0), nil
+	}
+	s.conn.pending[key] = args[3].(string)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *memStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.HasPrefix(s.query, "select") {
+		return nil, errors.New("unsupported query: " + s.query)
+	}
+	rows := memRows{}
+	if reason, ok := s.conn.get(s.key(args)); ok {
+		rows.reasons = append(rows.reasons, reason)
+	}
+	return &rows, nil
+}
+
+type memRows struct {
+	reasons []string
+}
+
+func (r *memRows) Columns() []string {
+	return []string{"reason"}
+}
+
+func (r *memRows) Close() error {
+	return nil
+}
+
+func (r *memRows) Next(dest []driver.Value) error {
+	if len(r.reasons) == 0 {
+		return io.EOF
+	}
+	dest[0], r.reasons = r.reasons[0], r.reasons[1:]
+	return nil
+}
+
+// barrierComponent 业务逻辑完全交由屏障保护的 TCC 组件, 记录每个阶段业务逻辑的执行次数
+type barrierComponent struct {
+	barrier *SQLBarrier
+	reject  bool
+
+	mux   sync.Mutex
+	calls map[Phase]int
+}
+
+func newBarrierComponent() *barrierComponent {
+	return &barrierComponent{
+		barrier: NewSQLBarrier(sql.OpenDB(newMemStore()), "barrier"),
+		calls:   make(map[Phase]int),
+	}
+}
+
+func (b *barrierComponent) biz(phase Phase) BizFunc {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		if b.reject {
+			return ErrReject
+		}
+		b.mux.Lock()
+		defer b.mux.Unlock()
+		b.calls[phase]++
+		return nil
+	}
+}
+
+func (b *barrierComponent) ID() string {
+	return "barrier"
+}
+
+func (b *barrierComponent) Try(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+	return b.barrier.Try(ctx, req, b.biz(PhaseTry))
+}
+
+func (b *barrierComponent) Confirm(ctx context.Context, txID string) (*component.TCCResp, error) {
+	return b.barrier.Confirm(ctx, txID, b.biz(PhaseConfirm))
+}
+
+func (b *barrierComponent) Cancel(ctx context.Context, txID string) (*component.TCCResp, error) {
+	return b.barrier.Cancel(ctx, txID, b.biz(PhaseCancel))
+}
+
+func Test_SQLBarrier_ComponentSuite(t *testing.T) {
+	componenttest.RunTCCComponentSuite(t, func() component.TCCComponent {
+		return newBarrierComponent()
+	}, nil)
+}
+
+func Test_SQLBarrier_BizCalledOnce(t *testing.T) {
+	ctx := context.Background()
+	c := newBarrierComponent()
+	req := &component.TCCReq{ComponentID: c.ID(), TXID: "1"}
+	for i := 0; i < 2; i++ {
+		if resp, err := c.Try(ctx, req); err != nil || !resp.ACK {
+			t.Fatalf("try %d not accepted, resp: %+v, err: %v", i+1, resp, err)
+		}
+		if resp, err := c.Confirm(ctx, req.TXID); err != nil || !resp.ACK {
+			t.Fatalf("confirm %d not accepted, resp: %+v, err: %v", i+1, resp, err)
+		}
+	}
+	if c.calls[PhaseTry] != 1 || c.calls[PhaseConfirm] != 1 {
+		t.Errorf("biz calls: %v, expected try and confirm once", c.calls)
+	}
+
+	// 空回滚不执行业务逻辑
+	if resp, err := c.Cancel(ctx, "2"); err != nil || !resp.ACK {
+		t.Fatalf("empty rollback not accepted, resp: %+v, err: %v", resp, err)
+	}
+	if c.calls[PhaseCancel] != 0 {
+		t.Errorf("cancel biz called %d times on empty rollback", c.calls[PhaseCancel])
+	}
+}
+
+func Test_SQLBarrier_Reject(t *testing.T) {
+	ctx := context.Background()
+	c := newBarrierComponent()
+	c.reject = true
+	req := &component.TCCReq{ComponentID: c.ID(), TXID: "1"}
+	resp, err := c.Try(ctx, req)
+	if err != nil || resp.ACK {
+		t.Fatalf("rejected try, resp: %+v, err: %v, expected nack without error", resp, err)
+	}
+
+	// 被拒绝的 try 不会留下屏障记录, 之后的 try 可以正常执行
+	c.reject = false
+	if resp, err = c.Try(ctx, req); err != nil || !resp.ACK {
+		t.Fatalf("try after reject not accepted, resp: %+v, err: %v", resp, err)
+	}
+}
@@ -17,6 +17,28 @@ type TCCReq struct {
 	// 全局唯一的事务 id
 	TXID string                 `json:"txID"`
 	Data map[string]interface{} `json:"data"`
+	// 透传给组件的元数据, 例如 TX Manager 注入的 trace 上下文(W3C traceparent 等)
+	// 远程组件可以通过 OpenTelemetry 的 propagation.MapCarrier(req.Metadata) 提取 trace 上下文并延续链路
+	// Confirm、Cancel 不接收 TCCReq, 元数据需要通过 MetadataFromContext 从 ctx 中获取
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// metadataKey 元数据在 ctx 中的 key
+type metadataKey struct{}
+
+// WithMetadata 返回携带元数据的 ctx, TX Manager 调用组件的每个阶段时都会注入与 TCCReq.Metadata 相同的元数据
+func WithMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	if len(metadata) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, metadataKey{}, metadata)
+}
+
+// MetadataFromContext 获取 ctx 中携带的元数据, 没有元数据时返回 nil
+// Confirm、Cancel 可以据此获取 trace 上下文, 例如 propagation.MapCarrier(component.MetadataFromContext(ctx))
+func MetadataFromContext(ctx context.Context) map[string]string {
+	metadata, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return metadata
 }
 
 // TCCResp 响应结果
@@ -38,3 +60,17 @@ type TCCComponent interface {
 	// Cancel 执行第二阶段的 cancel 操作
 	Cancel(ctx context.Context, txID string) (*TCCResp, error)
 }
+
+// SagaComponent Saga 组件
+// 适用于无法提供资源预留(Try)能力的下游服务, 仅需提供正向操作以及对应的补偿操作
+// 1. 事务中的各 Saga 组件按照声明顺序依次执行正向操作 Action
+// 2. 一旦某个组件的正向操作失败, 则按照逆序对已执行的组件执行补偿操作 Compensate
+// 3. Compensate 需要支持幂等以及空补偿(正向操作未执行时收到补偿请求)
+type SagaComponent interface {
+	// ID 返回组件唯一 id
+	ID() string
+	// Action 执行正向操作
+	Action(ctx context.Context, req *TCCReq) (*TCCResp, error)
+	// Compensate 执行补偿操作, req 中携带的是正向操作时的请求参数
+	Compensate(ctx context.Context, req *TCCReq) (*TCCResp, error)
+}
@@ -0,0 +1,228 @@
+// Package componenttest 提供 TCC 组件的一致性测试工具
+// 通过对组件驱动一系列对抗性的调用序列, 校验组件是否满足幂等、空回滚以及防悬挂等 TCC 约束
+package componenttest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+)
+
+// Invariant TCC 组件需要满足的约束
+type Invariant string
+
+func (i Invariant) String() string {
+	return string(i)
+}
+
+const (
+	// 幂等 try: 重复的 try 请求需要给予相同的成功响应
+	IdempotentTry Invariant = "idempotent_try"
+	// 幂等 confirm: 重复的 confirm 请求需要给予成功响应
+	IdempotentConfirm Invariant = "idempotent_confirm"
+	// 幂等 cancel: 重复的 cancel 请求需要给予成功响应
+	IdempotentCancel Invariant = "idempotent_cancel"
+	// 空回滚: 未收到 try 请求时收到 cancel 请求, 需要给予成功响应
+	EmptyRollback Invariant = "empty_rollback"
+	// 防悬挂: 先 cancel 后收到 try 请求, 需要拒绝 try
+	AntiSuspension Invariant = "anti_suspension"
+	// cancel 之后收到 confirm 请求, 属于非法的状态扭转, 需要拒绝 confirm
+	RejectConfirmAfterCancel Invariant = "reject_confirm_after_cancel"
+	// 并发的 confirm 和 cancel 请求至多只能有一个成功
+	ExclusiveConfirmCancel Invariant = "exclusive_confirm_cancel"
+)
+
+// Violation 组件违反的约束
+type Violation struct {
+	Invariant Invariant
+	TXID      string
+	Detail    string
+}
+
+func (v *Violation) String() string {
+	return fmt.Sprintf("%s violated, tx id: %s, %s", v.Invariant, v.TXID, v.Detail)
+}
+
+// Factory 返回待校验的 TCC 组件, 每个调用序列都会调用一次
+type Factory func() component.TCCComponent
+
+// DataBuilder 针对事务 id 构造 try 请求中的业务参数
+type DataBuilder func(txID string) map[string]interface{}
+
+// check 单个调用序列, 组件满足约束时返回 nil
+type check func(ctx context.Context, c component.TCCComponent, req *component.TCCReq) *Violation
+
+var checks = []struct {
+	invariant Invariant
+	run       check
+}{
+	{IdempotentTry, checkIdempotentTry},
+	{IdempotentConfirm, checkIdempotentConfirm},
+	{IdempotentCancel, checkIdempotentCancel},
+	{EmptyRollback, checkEmptyRollback},
+	{AntiSuspension, checkAntiSuspension},
+	{RejectConfirmAfterCancel, checkRejectConfirmAfterCancel},
+	{ExclusiveConfirmCancel, checkExclusiveConfirmCancel},
+}
+
+// txSeq 用于生成全局唯一的事务 id, 避免不同调用序列之间共享存储时相互干扰
+var txSeq int64
+
+func newTXID() string {
+	return fmt.Sprintf("componenttest_%d_%d", time.Now().UnixNano(), atomic.AddInt64(&txSeq, 1))
+}
+
+// Check 针对组件驱动所有的调用序列, 返回组件违反的约束
+// 每个调用序列都使用全新的组件实例以及全新的事务 id
+func Check(ctx context.Context, factory Factory, newData DataBuilder) []*Violation {
+	var violations []*Violation
+	for _, c := range checks {
+		if violation := runCheck(ctx, factory, newData, c.invariant, c.run); violation != nil {
+			violations = append(violations, violation)
+		}
+	}
+	return violations
+}
+
+// RunTCCComponentSuite 以子测试的形式针对组件运行所有的调用序列, 每个约束对应一个子测试
+func RunTCCComponentSuite(t *testing.T, factory Factory, newData DataBuilder) {
+	for _, c := range checks {
+		c := c
+		t.Run(c.invariant.String(), func(t *testing.T) {
+			if violation := runCheck(context.Background(), factory, newData, c.invariant, c.run); violation != nil {
+				t.Error(violation)
+			}
+		})
+	}
+}
+
+func runCheck(ctx context.Context, factory Factory, newData DataBuilder, invariant Invariant, run check) *Violation {
+	c := factory()
+	txID := newTXID()
+	req := &component.TCCReq{
+		ComponentID: c.ID(),
+		TXID:        txID,
+	}
+	if newData != nil {
+		req.Data = newData(txID)
+	}
+
+	violation := run(ctx, c, req)
+	if violation != nil {
+		violation.Invariant = invariant
+		violation.TXID = txID
+	}
+	return violation
+}
+
+func violatef(format string, args ...interface{}) *Violation {
+	return &Violation{Detail: fmt.Sprintf(format, args...)}
+}
+
+// acked 判断组件是否给予了成功的响应
+func acked(resp *component.TCCResp, err error) bool {
+	return err == nil && resp != nil && resp.ACK
+}
+
+// mustTry 执行 try 并要求组件给予成功的响应, 作为其他调用序列的前置步骤
+func mustTry(ctx context.Context, c component.TCCComponent, req *component.TCCReq) *Violation {
+	if resp, err := c.Try(ctx, req); !acked(resp, err) {
+		return violatef("first try not accepted, resp: %+v, err: %v", resp, err)
+	}
+	return nil
+}
+
+func checkIdempotentTry(ctx context.Context, c component.TCCComponent, req *component.TCCReq) *Violation {
+	if violation := mustTry(ctx, c, req); violation != nil {
+		return violation
+	}
+	if resp, err := c.Try(ctx, req); !acked(resp, err) {
+		return violatef("duplicate try not accepted, resp: %+v, err: %v", resp, err)
+	}
+	return nil
+}
+
+func checkIdempotentConfirm(ctx context.Context, c component.TCCComponent, req *component.TCCReq) *Violation {
+	if violation := mustTry(ctx, c, req); violation != nil {
+		return violation
+	}
+	for i := 0; i < 2; i++ {
+		if resp, err := c.Confirm(ctx, req.TXID); !acked(resp, err) {
+			return violatef("confirm %d not accepted, resp: %+v, err: %v", i+1, resp, err)
+		}
+	}
+	return nil
+}
+
+func checkIdempotentCancel(ctx context.Context, c component.TCCComponent, req *component.TCCReq) *Violation {
+	if violation := mustTry(ctx, c, req); violation != nil {
+		return violation
+	}
+	for i := 0; i < 2; i++ {
+		if resp, err := c.Cancel(ctx, req.TXID); !acked(resp, err) {
+			return violatef("cancel %d not accepted, resp: %+v, err: %v", i+1, resp, err)
+		}
+	}
+	return nil
+}
+
+func checkEmptyRollback(ctx context.Context, c component.TCCComponent, req *component.TCCReq) *Violation {
+	if resp, err := c.Cancel(ctx, req.TXID); !acked(resp, err) {
+		return violatef("cancel before try not accepted, resp: %+v, err: %v", resp, err)
+	}
+	return nil
+}
+
+func checkAntiSuspension(ctx context.Context, c component.TCCComponent, req *component.TCCReq) *Violation {
+	if resp, err := c.Cancel(ctx, req.TXID); !acked(resp, err) {
+		return violatef("cancel before try not accepted, resp: %+v, err: %v", resp, err)
+	}
+	if resp, err := c.Try(ctx, req); acked(resp, err) {
+		return violatef("try after cancel accepted")
+	}
+	return nil
+}
+
+func checkRejectConfirmAfterCancel(ctx context.Context, c component.TCCComponent, req *component.TCCReq) *Violation {
+	if violation := mustTry(ctx, c, req); violation != nil {
+		return violation
+	}
+	if resp, err := c.Cancel(ctx, req.TXID); !acked(resp, err) {
+		return violatef("cancel not accepted, resp: %+v, err: %v", resp, err)
+	}
+	if resp, err := c.Confirm(ctx, req.TXID); acked(resp, err) {
+		return violatef("confirm after cancel accepted")
+	}
+	return nil
+}
+
+func checkExclusiveConfirmCancel(ctx context.Context, c component.TCCComponent, req *component.TCCReq) *Violation {
+	if violation := mustTry(ctx, c, req); violation != nil {
+		return violation
+	}
+
+	var wg sync.WaitGroup
+	var confirmed, canceled bool
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		resp, err := c.Confirm(ctx, req.TXID)
+		confirmed = acked(resp, err)
+	}()
+	go func() {
+		defer wg.Done()
+		resp, err := c.Cancel(ctx, req.TXID)
+		canceled = acked(resp, err)
+	}()
+	wg.Wait()
+
+	if confirmed && canceled {
+		return violatef("concurrent confirm and cancel both accepted")
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package componenttest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+)
+
+// memComponent 基于内存实现的、满足 TCC 约束的组件
+type memComponent struct {
+	mux      sync.Mutex
+	statuses map[string]string
+}
+
+func newMemComponent() component.TCCComponent {
+	return &memComponent{statuses: make(map[string]string)}
+}
+
+func (m *memComponent) ID() string {
+	return "mem"
+}
+
+func (m *memComponent) resp(txID string, ack bool) *component.TCCResp {
+	return &component.TCCResp{ComponentID: m.ID(), TXID: txID, ACK: ack}
+}
+
+func (m *memComponent) Try(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	switch m.statuses[req.TXID] {
+	case "tried", "confirmed":
+		return m.resp(req.TXID, true), nil
+	case "canceled":
+		return m.resp(req.TXID, false), nil
+	}
+	m.statuses[req.TXID] = "tried"
+	return m.resp(req.TXID, true), nil
+}
+
+func (m *memComponent) Confirm(ctx context.Context, txID string) (*component.TCCResp, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	switch m.statuses[txID] {
+	case "tried", "confirmed":
+		m.statuses[txID] = "confirmed"
+		return m.resp(txID, true), nil
+	}
+	return m.resp(txID, false), nil
+}
+
+func (m *memComponent) Cancel(ctx context.Context, txID string) (*component.TCCResp, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.statuses[txID] == "confirmed" {
+		return nil, errors.New("invalid tx status")
+	}
+	m.statuses[txID] = "canceled"
+	return m.resp(txID, true), nil
+}
+
+// naiveComponent 不做任何状态校验的组件
+type naiveComponent struct{}
+
+func (n *naiveComponent) ID() string {
+	return "naive"
+}
+
+func (n *naiveComponent) Try(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+	return &component.TCCResp{ComponentID: n.ID(), TXID: req.TXID, ACK: true}, nil
+}
+
+func (n *naiveComponent) Confirm(ctx context.Context, txID string) (*component.TCCResp, error) {
+	return &component.TCCResp{ComponentID: n.ID(), TXID: txID, ACK: true}, nil
+}
+
+func (n *naiveComponent) Cancel(ctx context.Context, txID string) (*component.TCCResp, error) {
+	return &component.TCCResp{ComponentID: n.ID(), TXID: txID, ACK: true}, nil
+}
+
+func Test_RunTCCComponentSuite(t *testing.T) {
+	RunTCCComponentSuite(t, newMemComponent, nil)
+}
+
+func Test_CheckViolations(t *testing.T) {
+	violations := Check(context.Background(), func() component.TCCComponent {
+		return &naiveComponent{}
+	}, nil)
+
+	got := make(map[Invariant]bool, len(violations))
+	for _, violation := range violations {
+		got[violation.Invariant] = true
+	}
+	for _, invariant := range []Invariant{AntiSuspension, RejectConfirmAfterCancel, ExclusiveConfirmCancel} {
+		if !got[invariant] {
+			t.Errorf("invariant: %s violation not reported", invariant)
+		}
+	}
+	for _, invariant := range []Invariant{IdempotentTry, IdempotentConfirm, IdempotentCancel, EmptyRollback} {
+		if got[invariant] {
+			t.Errorf("invariant: %s violation reported unexpectedly", invariant)
+		}
+	}
+}
@@ -13,8 +13,35 @@ func WithID(id uint) QueryOption {
 	}
 }
 
-func WithStatus(status txmanager.ComponentTryStatus) QueryOption {
+func WithStatus(status txmanager.TXStatus) QueryOption {
 	return func(db *gorm.DB) *gorm.DB {
 		return db.Where("status = ?", status.String())
 	}
 }
+
+// WithIDAfter 仅查询主键大于 id 的记录, 并按照主键由小到大排列, 用于基于主键的分页查询
+func WithIDAfter(id uint) QueryOption {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("id > ?", id).Order("id asc")
+	}
+}
+
+// WithLimit 限制查询的记录数量, limit 不大于 0 时不限制
+func WithLimit(limit int) QueryOption {
+	return func(db *gorm.DB) *gorm.DB {
+		if limit <= 0 {
+			return db
+		}
+		return db.Limit(limit)
+	}
+}
+
+// WithShards 仅查询属于指定分片的记录, 与 txmanager.ShardOf 的算法保持一致
+func WithShards(totalShards int, shards []int) QueryOption {
+	return func(db *gorm.DB) *gorm.DB {
+		if totalShards <= 0 {
+			return db
+		}
+		return db.Where("CRC32(id) % ? in ?", totalShards, shards)
+	}
+}
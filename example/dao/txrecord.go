@@ -3,6 +3,7 @@ package dao
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -10,7 +11,26 @@ import (
 type TXRecordPO struct {
 	gorm.Model
 	Status               string `gorm:"status"`
+	Mode                 string `gorm:"mode"`
 	ComponentTryStatuses string `gorm:"component_try_statuses"`
+	// 事务的截止时间, 早期版本创建的事务记录中为空
+	Deadline *time.Time `gorm:"deadline"`
+	// 创建事务的节点对事务第一阶段的所有权租约的到期时间
+	OwnerExpireAt *time.Time `gorm:"owner_expire_at"`
+	// 事务第一阶段根 span 的 W3C traceparent, 未开启链路追踪时为空
+	TraceParent string `gorm:"trace_parent"`
+	// 推进事务第二阶段失败的累计次数
+	Attempts int `gorm:"attempts"`
+	// 下一次重试的时间, 尚未失败过的事务为空
+	NextRetryAt *time.Time `gorm:"next_retry_at"`
+	// 最近一次推进失败的原因
+	LastError string `gorm:"last_error"`
+	// 事务已经接受过的最大 fencing token
+	FencingToken int64 `gorm:"fencing_token"`
+	// 运维人员强制决议的事务状态, 未被强制决议时为空
+	ForcedStatus string `gorm:"forced_status"`
+	// 强制决议的原因
+	ForceReason string `gorm:"force_reason"`
 }
 
 func (t TXRecordPO) TableName() string {
@@ -18,8 +38,12 @@ func (t TXRecordPO) TableName() string {
 }
 
 type ComponentTryStatus struct {
-	ComponentID string `json:"componentID"`
-	TryStatus   string `json:"tryStatus"`
+	ComponentID string                 `json:"componentID"`
+	TryStatus   string                 `json:"tryStatus"`
+	Request     map[string]interface{} `json:"request"`
+	DependsOn   []string               `json:"dependsOn"`
+	// 组件在事务中的次序
+	Index int `json:"index"`
 }
 
 type TXRecordDAO struct {
@@ -46,8 +70,8 @@ func (t *TXRecordDAO) CreateTXRecord(ctx context.Context, record *TXRecordPO) (u
 	return record.ID, t.db.WithContext(ctx).Model(&TXRecordPO{}).Create(record).Error
 }
 
-func (t *TXRecordDAO) UpdateComponentStatus(ctx context.Context, id uint, componentID string, status string) error {
-	return t.db.WithContext(ctx).Exec(fmt.Sprintf("update tx_record set component_try_statuses = json_replace(component_try_statuses,'$.%s.tryStatus','%s') where id = %d", componentID, status, id)).Error
+func (t *TXRecordDAO) UpdateComponentStatus(ctx context.Context, id uint, componentID string, status string, fencingToken int64) error {
+	return t.db.WithContext(ctx).Exec(fmt.Sprintf("update tx_record set component_try_statuses = json_replace(component_try_statuses,'$.%s.tryStatus','%s'), fencing_token = %d where id = %d", componentID, status, fencingToken, id)).Error
 }
 
 func (t *TXRecordDAO) UpdateTXRecord(ctx context.Context, record *TXRecordPO) error {
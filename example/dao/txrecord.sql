@@ -1,8 +1,18 @@
 CREATE TABLE IF NOT EXISTS `tx_record`
 (
     `id`                       bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键ID',
-    `status`                   varchar(16) NOT NULL COMMENT '事务状态 hanging/successful/failure',
+    `status`                   varchar(16) NOT NULL COMMENT '事务状态 hanging/successful/failure/dead_letter',
+    `mode`                     varchar(16) NOT NULL DEFAULT 'tcc' COMMENT '事务执行模式 tcc/saga',
     `component_try_statuses`   json DEFAULT NULL COMMENT '各组件 try 接口请求状态 hanging/successful/failure',
+    `deadline`          datetime     DEFAULT NULL COMMENT '事务截止时间',
+    `owner_expire_at`   datetime     DEFAULT NULL COMMENT '创建事务的节点对事务第一阶段的所有权租约的到期时间',
+    `trace_parent`      varchar(64)  NOT NULL DEFAULT '' COMMENT '事务第一阶段根 span 的 W3C traceparent',
+    `attempts`          int(11)      NOT NULL DEFAULT 0 COMMENT '推进事务第二阶段失败的累计次数',
+    `next_retry_at`     datetime     DEFAULT NULL COMMENT '下一次重试的时间',
+    `last_error`        text         NOT NULL COMMENT '最近一次推进失败的原因',
+    `fencing_token`     bigint(20)   NOT NULL DEFAULT 0 COMMENT '事务已经接受过的最大 fencing token',
+    `forced_status`     varchar(16)  NOT NULL DEFAULT '' COMMENT '运维人员强制决议的事务状态 successful/failure',
+    `force_reason`      text         NOT NULL COMMENT '强制决议的原因',
     `deleted_at`        datetime     DEFAULT NULL COMMENT '删除时间',
     `created_at`        datetime     NOT NULL COMMENT '创建时间',
     `updated_at`        datetime     DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
@@ -32,11 +32,6 @@ func GetRedisClient() *redis_lock.Client {
 	return redisClient
 }
 
-// BuildTXKey 构造事务 id key，用于幂等去重
-func BuildTXKey(componentID, txID string) string {
-	return fmt.Sprintf("txKey:%s:%s", componentID, txID)
-}
-
 // BuildTXDetailKey 构造事务事务细节 key
 func BuildTXDetailKey(componentID, txID string) string {
 	return fmt.Sprintf("txDetailKey:%s:%s", componentID, txID)
@@ -44,15 +39,20 @@ func BuildTXDetailKey(componentID, txID string) string {
 
 // BuildDataKey 构造请求 id，用于记录状态机
 func BuildDataKey(componentID, txID, bizID string) string {
-	return fmt.Sprintf("txKey:%s:%s:%s", componentID, txID, bizID)
+	return BuildDataKeyPrefix(componentID, txID) + bizID
 }
 
-// BuildTXLockKey 构造事务锁 key
-func BuildTXLockKey(componentID, txID string) string {
-	return fmt.Sprintf("txLockKey:%s:%s", componentID, txID)
+// BuildDataKeyPrefix 构造请求 id 的前缀, 拼接 bizID 后即为 BuildDataKey 的结果, 供 lua 脚本中拼接 key 使用
+func BuildDataKeyPrefix(componentID, txID string) string {
+	return fmt.Sprintf("txKey:%s:%s:", componentID, txID)
 }
 
 // BuildTXRecordLockKey 返回一个构建事务记录锁的键
 func BuildTXRecordLockKey() string {
 	return "gotcc:txRecord:lock"
 }
+
+// BuildTXRecordLockTokenKey 返回事务记录锁的 fencing token 计数器的键
+func BuildTXRecordLockTokenKey() string {
+	return "gotcc:txRecord:lock:token"
+}
@@ -4,9 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
 	"time"
 
-	"github.com/xiaoxuxiansheng/gotcc/component"
 	expdao "github.com/xiaoxuxiansheng/gotcc/example/dao"
 	"github.com/xiaoxuxiansheng/gotcc/example/pkg"
 	"github.com/xiaoxuxiansheng/gotcc/txmanager"
@@ -27,20 +28,27 @@ func NewMockTXStore(dao *expdao.TXRecordDAO, client *redis_lock.Client) *MockTXS
 	}
 }
 
-func (m *MockTXStore) CreateTX(ctx context.Context, components ...component.TCCComponent) (string, error) {
+func (m *MockTXStore) CreateTX(ctx context.Context, tx *txmanager.Transaction) (string, error) {
 	// 创建一项内容，里面以唯一事务 id 为 key
-	componentTryStatuses := make(map[string]*expdao.ComponentTryStatus, len(components))
-	for _, component := range components {
-		componentTryStatuses[component.ID()] = &expdao.ComponentTryStatus{
-			ComponentID: component.ID(),
+	componentTryStatuses := make(map[string]*expdao.ComponentTryStatus, len(tx.Components))
+	for i, component := range tx.Components {
+		componentTryStatuses[component.ComponentID] = &expdao.ComponentTryStatus{
+			ComponentID: component.ComponentID,
 			TryStatus:   txmanager.TryHanging.String(),
+			Request:     component.Request,
+			DependsOn:   component.DependsOn,
+			Index:       i,
 		}
 	}
 
 	statusesBody, _ := json.Marshal(componentTryStatuses)
 	txID, err := m.dao.CreateTXRecord(ctx, &expdao.TXRecordPO{
 		Status:               txmanager.TXHanging.String(),
+		Mode:                 tx.Mode.String(),
 		ComponentTryStatuses: string(statusesBody),
+		Deadline:             &tx.Deadline,
+		OwnerExpireAt:        &tx.OwnerExpireAt,
+		TraceParent:          tx.TraceParent,
 	})
 	if err != nil {
 		return "", err
@@ -50,56 +58,146 @@ func (m *MockTXStore) CreateTX(ctx context.Context, components ...component.TCCC
 }
 
 func (m *MockTXStore) TXUpdate(ctx context.Context, txID string, componentID string, accept bool) error {
-	_txID := gocast.ToUint(txID)
 	status := txmanager.TXFailure.String()
 	if accept {
 		status = txmanager.TXSuccessful.String()
 	}
-	return m.dao.UpdateComponentStatus(ctx, _txID, componentID, status)
+	// 持有行锁校验 fencing token, 拒绝已经退位的 leader 的写入
+	do := func(ctx context.Context, dao *expdao.TXRecordDAO, record *expdao.TXRecordPO) error {
+		token, err := txmanager.CheckFencingToken(ctx, record.FencingToken)
+		if err != nil {
+			return err
+		}
+		// 持有行锁校验组件的 try 结果尚未写入, 已经写入的结果不允许被覆盖
+		componentTryStatuses := make(map[string]*expdao.ComponentTryStatus)
+		if err = json.Unmarshal([]byte(record.ComponentTryStatuses), &componentTryStatuses); err != nil {
+			return err
+		}
+		tryItem, ok := componentTryStatuses[componentID]
+		if !ok {
+			return fmt.Errorf("component: %s not existed in tx: %s", componentID, txID)
+		}
+		if tryItem.TryStatus != txmanager.TryHanging.String() {
+			return fmt.Errorf("%w, component: %s, try status: %s", txmanager.ErrTryDecided, componentID, tryItem.TryStatus)
+		}
+		return dao.UpdateComponentStatus(ctx, record.ID, componentID, status, token)
+	}
+	return m.dao.LockAndDo(ctx, gocast.ToUint(txID), do)
 }
 
-func (m *MockTXStore) GetHangingTXs(ctx context.Context) ([]*txmanager.Transaction, error) {
-	records, err := m.dao.GetTXRecords(ctx, expdao.WithStatus(txmanager.TryHanging))
+// 续约创建事务的节点对事务第一阶段的所有权租约
+func (m *MockTXStore) TXRenewOwner(ctx context.Context, txID string, expireAt time.Time) error {
+	do := func(ctx context.Context, dao *expdao.TXRecordDAO, record *expdao.TXRecordPO) error {
+		if record.Status != txmanager.TXHanging.String() {
+			return fmt.Errorf("tx: %s already finished, status: %s", txID, record.Status)
+		}
+		record.OwnerExpireAt = &expireAt
+		return dao.UpdateTXRecord(ctx, record)
+	}
+	return m.dao.LockAndDo(ctx, gocast.ToUint(txID), do)
+}
+
+// GetHangingTXs 基于自增主键分页, 主键的先后顺序与事务的创建顺序一致, 游标为上一页最后一条记录的主键
+func (m *MockTXStore) GetHangingTXs(ctx context.Context, query txmanager.HangingQuery) ([]*txmanager.Transaction, string, error) {
+	// 多查询一条记录用于判断是否还有下一页
+	limit := query.Limit
+	if limit > 0 {
+		limit++
+	}
+	records, err := m.dao.GetTXRecords(ctx, expdao.WithStatus(txmanager.TXHanging), expdao.WithShards(query.TotalShards, query.Shards),
+		expdao.WithIDAfter(gocast.ToUint(query.Cursor)), expdao.WithLimit(limit))
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	var next string
+	if query.Limit > 0 && len(records) > query.Limit {
+		records = records[:query.Limit]
+		next = gocast.ToString(records[query.Limit-1].ID)
 	}
 
 	txs := make([]*txmanager.Transaction, 0, len(records))
 	for _, record := range records {
-		componentTryStatuses := make(map[string]*expdao.ComponentTryStatus)
-		_ = json.Unmarshal([]byte(record.ComponentTryStatuses), &componentTryStatuses)
-		components := make([]*txmanager.ComponentTryEntity, 0, len(componentTryStatuses))
-		for _, component := range componentTryStatuses {
-			components = append(components, &txmanager.ComponentTryEntity{
-				ComponentID: component.ComponentID,
-				TryStatus:   txmanager.ComponentTryStatus(component.TryStatus),
-			})
-		}
-
 		txs = append(txs, &txmanager.Transaction{
-			TXID:       gocast.ToString(record.ID),
-			Status:     txmanager.TXHanging,
-			CreatedAt:  record.CreatedAt,
-			Components: components,
+			TXID:          gocast.ToString(record.ID),
+			Status:        txmanager.TXHanging,
+			Mode:          txmanager.TXMode(record.Mode),
+			CreatedAt:     record.CreatedAt,
+			Deadline:      deadlineOf(record),
+			OwnerExpireAt: ownerExpireAtOf(record),
+			TraceParent:   record.TraceParent,
+			Attempts:      record.Attempts,
+			NextRetryAt:   nextRetryAtOf(record),
+			LastError:     record.LastError,
+			ForcedStatus:  txmanager.TXStatus(record.ForcedStatus),
+			ForceReason:   record.ForceReason,
+			Components:    buildComponents(record.ComponentTryStatuses),
 		})
 	}
 
-	return txs, nil
+	return txs, next, nil
+}
+
+// 加锁脚本: 锁未被持有时由计数器生成单调递增的 fencing token, 并以 token 作为锁的值
+const lockScript = `
+if redis.call('EXISTS', KEYS[1]) == 1 then return 0 end
+local token = redis.call('INCR', KEYS[2])
+redis.call('SET', KEYS[1], token, 'PX', ARGV[1])
+return token
+`
+
+// 续约脚本: 锁仍由 token 持有时重置过期时间
+const renewLockScript = `
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then return 0 end
+return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+`
+
+// 解锁脚本: 锁仍由 token 持有时删除
+const unlockScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then redis.call('DEL', KEYS[1]) end
+return 1
+`
+
+func (m *MockTXStore) Lock(ctx context.Context, expireDuration time.Duration) (int64, error) {
+	reply, err := m.client.Eval(ctx, lockScript, 2, []interface{}{
+		pkg.BuildTXRecordLockKey(), pkg.BuildTXRecordLockTokenKey(), expireDuration.Milliseconds(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	token := gocast.ToInt64(reply)
+	if token == 0 {
+		return 0, errors.New("tx store locked")
+	}
+	return token, nil
 }
 
-func (m *MockTXStore) Lock(ctx context.Context, expireDuration time.Duration) error {
-	lock := redis_lock.NewRedisLock(pkg.BuildTXRecordLockKey(), m.client, redis_lock.WithExpireSeconds(int64(expireDuration.Seconds())))
-	return lock.Lock(ctx)
+func (m *MockTXStore) RenewLock(ctx context.Context, token int64, expireDuration time.Duration) error {
+	reply, err := m.client.Eval(ctx, renewLockScript, 1, []interface{}{
+		pkg.BuildTXRecordLockKey(), token, expireDuration.Milliseconds(),
+	})
+	if err != nil {
+		return err
+	}
+	if gocast.ToInt64(reply) != 1 {
+		return fmt.Errorf("lock not held by token: %d", token)
+	}
+	return nil
 }
 
-func (m *MockTXStore) Unlock(ctx context.Context) error {
-	lock := redis_lock.NewRedisLock(pkg.BuildTXRecordLockKey(), m.client)
-	return lock.Unlock(ctx)
+func (m *MockTXStore) Unlock(ctx context.Context, token int64) error {
+	_, err := m.client.Eval(ctx, unlockScript, 1, []interface{}{pkg.BuildTXRecordLockKey(), token})
+	return err
 }
 
 // 提交事务的最终状态
 func (m *MockTXStore) TXSubmit(ctx context.Context, txID string, success bool) error {
 	do := func(ctx context.Context, dao *expdao.TXRecordDAO, record *expdao.TXRecordPO) error {
+		token, err := txmanager.CheckFencingToken(ctx, record.FencingToken)
+		if err != nil {
+			return err
+		}
+		record.FencingToken = token
 		if success {
 			record.Status = txmanager.TXSuccessful.String()
 		} else {
@@ -110,6 +208,66 @@ func (m *MockTXStore) TXSubmit(ctx context.Context, txID string, success bool) e
 	return m.dao.LockAndDo(ctx, gocast.ToUint(txID), do)
 }
 
+// 记录推进事务第二阶段失败的结果
+func (m *MockTXStore) TXRetry(ctx context.Context, txID string, attempts int, nextRetryAt time.Time, lastErr string) error {
+	do := func(ctx context.Context, dao *expdao.TXRecordDAO, record *expdao.TXRecordPO) error {
+		if record.Status != txmanager.TXHanging.String() {
+			return fmt.Errorf("tx: %s already finished, status: %s", txID, record.Status)
+		}
+		token, err := txmanager.CheckFencingToken(ctx, record.FencingToken)
+		if err != nil {
+			return err
+		}
+		record.FencingToken = token
+		record.Attempts = attempts
+		record.NextRetryAt = &nextRetryAt
+		record.LastError = lastErr
+		return dao.UpdateTXRecord(ctx, record)
+	}
+	return m.dao.LockAndDo(ctx, gocast.ToUint(txID), do)
+}
+
+// 将事务置为 dead_letter 终态
+func (m *MockTXStore) TXDeadLetter(ctx context.Context, txID string, lastErr string) error {
+	do := func(ctx context.Context, dao *expdao.TXRecordDAO, record *expdao.TXRecordPO) error {
+		if record.Status != txmanager.TXHanging.String() && record.Status != txmanager.TXDeadLetter.String() {
+			return fmt.Errorf("tx: %s already finished, status: %s", txID, record.Status)
+		}
+		token, err := txmanager.CheckFencingToken(ctx, record.FencingToken)
+		if err != nil {
+			return err
+		}
+		record.FencingToken = token
+		record.Status = txmanager.TXDeadLetter.String()
+		record.LastError = lastErr
+		return dao.UpdateTXRecord(ctx, record)
+	}
+	return m.dao.LockAndDo(ctx, gocast.ToUint(txID), do)
+}
+
+// 持久化强制决议以及原因
+func (m *MockTXStore) TXForce(ctx context.Context, txID string, success bool, reason string) error {
+	status := txmanager.TXFailure.String()
+	if success {
+		status = txmanager.TXSuccessful.String()
+	}
+	do := func(ctx context.Context, dao *expdao.TXRecordDAO, record *expdao.TXRecordPO) error {
+		if record.Status != txmanager.TXHanging.String() && record.Status != txmanager.TXDeadLetter.String() {
+			return fmt.Errorf("tx: %s already finished, status: %s", txID, record.Status)
+		}
+		if record.ForcedStatus != "" {
+			if record.ForcedStatus != status {
+				return fmt.Errorf("tx: %s already forced, status: %s", txID, record.ForcedStatus)
+			}
+			return nil
+		}
+		record.ForcedStatus = status
+		record.ForceReason = reason
+		return dao.UpdateTXRecord(ctx, record)
+	}
+	return m.dao.LockAndDo(ctx, gocast.ToUint(txID), do)
+}
+
 // 获取指定的一笔事务
 func (m *MockTXStore) GetTX(ctx context.Context, txID string) (*txmanager.Transaction, error) {
 	records, err := m.dao.GetTXRecords(ctx, expdao.WithID(gocast.ToUint(txID)))
@@ -120,20 +278,68 @@ func (m *MockTXStore) GetTX(ctx context.Context, txID string) (*txmanager.Transa
 		return nil, errors.New("get tx failed")
 	}
 
+	return &txmanager.Transaction{
+		TXID:          txID,
+		Status:        txmanager.TXStatus(records[0].Status),
+		Mode:          txmanager.TXMode(records[0].Mode),
+		Components:    buildComponents(records[0].ComponentTryStatuses),
+		CreatedAt:     records[0].CreatedAt,
+		Deadline:      deadlineOf(records[0]),
+		OwnerExpireAt: ownerExpireAtOf(records[0]),
+		TraceParent:   records[0].TraceParent,
+		Attempts:      records[0].Attempts,
+		NextRetryAt:   nextRetryAtOf(records[0]),
+		LastError:     records[0].LastError,
+		ForcedStatus:  txmanager.TXStatus(records[0].ForcedStatus),
+		ForceReason:   records[0].ForceReason,
+	}, nil
+}
+
+// deadlineOf 返回事务记录的截止时间, 早期版本创建的事务记录返回零值, 由 TXManager 根据 Timeout 配置推算
+func deadlineOf(record *expdao.TXRecordPO) time.Time {
+	if record.Deadline == nil {
+		return time.Time{}
+	}
+	return *record.Deadline
+}
+
+// ownerExpireAtOf 返回事务记录的所有权租约到期时间, 早期版本创建的事务记录返回零值, 视为已经被创建事务的节点放弃
+func ownerExpireAtOf(record *expdao.TXRecordPO) time.Time {
+	if record.OwnerExpireAt == nil {
+		return time.Time{}
+	}
+	return *record.OwnerExpireAt
+}
+
+// nextRetryAtOf 返回事务记录的下一次重试时间, 尚未失败过的事务返回零值
+func nextRetryAtOf(record *expdao.TXRecordPO) time.Time {
+	if record.NextRetryAt == nil {
+		return time.Time{}
+	}
+	return *record.NextRetryAt
+}
+
+// buildComponents 解析事务记录中各组件的 try 状态, 并按照组件在事务中的次序排列
+func buildComponents(componentTryStatusesBody string) []*txmanager.ComponentTryEntity {
 	componentTryStatuses := make(map[string]*expdao.ComponentTryStatus)
-	_ = json.Unmarshal([]byte(records[0].ComponentTryStatuses), &componentTryStatuses)
+	_ = json.Unmarshal([]byte(componentTryStatusesBody), &componentTryStatuses)
 
-	components := make([]*txmanager.ComponentTryEntity, 0, len(componentTryStatuses))
+	tryItems := make([]*expdao.ComponentTryStatus, 0, len(componentTryStatuses))
 	for _, tryItem := range componentTryStatuses {
+		tryItems = append(tryItems, tryItem)
+	}
+	sort.Slice(tryItems, func(i, j int) bool {
+		return tryItems[i].Index < tryItems[j].Index
+	})
+
+	components := make([]*txmanager.ComponentTryEntity, 0, len(tryItems))
+	for _, tryItem := range tryItems {
 		components = append(components, &txmanager.ComponentTryEntity{
 			ComponentID: tryItem.ComponentID,
 			TryStatus:   txmanager.ComponentTryStatus(tryItem.TryStatus),
+			Request:     tryItem.Request,
+			DependsOn:   tryItem.DependsOn,
 		})
 	}
-	return &txmanager.Transaction{
-		TXID:       txID,
-		Status:     txmanager.TXStatus(records[0].Status),
-		Components: components,
-		CreatedAt:  records[0].CreatedAt,
-	}, nil
+	return components
 }
@@ -0,0 +1,132 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// 事务相关的通用字段名, TX Manager 与 TCC 组件使用相同的字段名, 便于在日志系统中按照事务 id 检索整条链路
+const (
+	KeyTXID        = "txID"
+	KeyComponentID = "componentID"
+	KeyPhase       = "phase"
+	KeyAttempt     = "attempt"
+)
+
+type fieldsKey struct{}
+
+// WithFields 返回携带了 key/value 字段的 context, 字段会追加在 ctx 已携带的字段之后
+// 通过 *Context、*Contextf、*Contextw 系列函数以及 ContextLogger 打印日志时, 字段会自动附加在每一行日志中
+func WithFields(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	if len(keysAndValues) == 0 {
+		return ctx
+	}
+	parent := Fields(ctx)
+	fields := make([]interface{}, 0, len(parent)+len(keysAndValues))
+	fields = append(fields, parent...)
+	fields = append(fields, keysAndValues...)
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// Fields 返回 ctx 中携带的 key/value 字段
+func Fields(ctx context.Context) []interface{} {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]interface{})
+	return fields
+}
+
+// ContextLogger 返回附加了 ctx 中携带字段的日志实现
+// logger 未实现 StructuredLogger 时, 字段以 key=value 的形式拼接在日志内容之后
+func ContextLogger(ctx context.Context, logger Logger) StructuredLogger {
+	structured, ok := logger.(StructuredLogger)
+	if !ok {
+		structured = &plainLogger{Logger: logger}
+	}
+	if fields := Fields(ctx); len(fields) > 0 {
+		return structured.With(fields...)
+	}
+	return structured
+}
+
+// plainLogger 将仅实现了 Logger 的日志实现适配为 StructuredLogger
+type plainLogger struct {
+	Logger
+	fields []interface{}
+}
+
+func (p *plainLogger) With(keysAndValues ...interface{}) StructuredLogger {
+	fields := make([]interface{}, 0, len(p.fields)+len(keysAndValues))
+	fields = append(fields, p.fields...)
+	fields = append(fields, keysAndValues...)
+	return &plainLogger{Logger: p.Logger, fields: fields}
+}
+
+// format 将日志内容与字段拼接为一行
+func (p *plainLogger) format(msg string, keysAndValues []interface{}) string {
+	fields := append(append([]interface{}{}, p.fields...), keysAndValues...)
+	if len(fields) == 0 {
+		return msg
+	}
+
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(fields); i += 2 {
+		if i+1 < len(fields) {
+			fmt.Fprintf(&b, " %v=%v", fields[i], fields[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", fields[i])
+		}
+	}
+	return b.String()
+}
+
+func (p *plainLogger) Error(v ...interface{}) {
+	p.Logger.Error(p.format(fmt.Sprint(v...), nil))
+}
+
+func (p *plainLogger) Warn(v ...interface{}) {
+	p.Logger.Warn(p.format(fmt.Sprint(v...), nil))
+}
+
+func (p *plainLogger) Info(v ...interface{}) {
+	p.Logger.Info(p.format(fmt.Sprint(v...), nil))
+}
+
+func (p *plainLogger) Debug(v ...interface{}) {
+	p.Logger.Debug(p.format(fmt.Sprint(v...), nil))
+}
+
+func (p *plainLogger) Errorf(format string, v ...interface{}) {
+	p.Logger.Error(p.format(fmt.Sprintf(format, v...), nil))
+}
+
+func (p *plainLogger) Warnf(format string, v ...interface{}) {
+	p.Logger.Warn(p.format(fmt.Sprintf(format, v...), nil))
+}
+
+func (p *plainLogger) Infof(format string, v ...interface{}) {
+	p.Logger.Info(p.format(fmt.Sprintf(format, v...), nil))
+}
+
+func (p *plainLogger) Debugf(format string, v ...interface{}) {
+	p.Logger.Debug(p.format(fmt.Sprintf(format, v...), nil))
+}
+
+func (p *plainLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	p.Logger.Error(p.format(msg, keysAndValues))
+}
+
+func (p *plainLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	p.Logger.Warn(p.format(msg, keysAndValues))
+}
+
+func (p *plainLogger) Infow(msg string, keysAndValues ...interface{}) {
+	p.Logger.Info(p.format(msg, keysAndValues))
+}
+
+func (p *plainLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	p.Logger.Debug(p.format(msg, keysAndValues))
+}
@@ -2,6 +2,8 @@ package log
 
 import (
 	"context"
+	"os"
+	"sync"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -19,14 +21,24 @@ type Logger interface {
 	Debugf(format string, v ...interface{})
 }
 
+// StructuredLogger 支持 key/value 结构化字段的日志实现, 是 Logger 的增强版本
+// 未实现该接口的 Logger 会由 ContextLogger 适配, 字段以 key=value 的形式拼接在日志内容之后
+type StructuredLogger interface {
+	Logger
+	Errorw(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Debugw(msg string, keysAndValues ...interface{})
+	// With 返回携带了额外字段的日志实现, 字段会附加在之后打印的每一行日志中
+	With(keysAndValues ...interface{}) StructuredLogger
+}
+
 var (
-	defaultLogger Logger
+	mux sync.RWMutex
+	// 默认日志实现输出到标准输出, 不会在未经使用方允许的情况下创建日志文件
+	defaultLogger Logger = NewStdoutLogger()
 )
 
-func init() {
-	defaultLogger = newSugarLogger(NewOptions())
-}
-
 // Options 选项配置
 type Options struct {
 	LogName    string // 日志名称
@@ -36,8 +48,16 @@ type Options struct {
 	MaxSize    int    // 日志保留大小，以 M 为单位
 	MaxBackups int    // 保留文件个数
 	Compress   bool   // 是否压缩
+	Encoding   string // 日志编码格式 console/json
 }
 
+const (
+	// EncodingConsole 便于人阅读的文本格式
+	EncodingConsole = "console"
+	// EncodingJSON 便于日志采集系统解析的 JSON 格式
+	EncodingJSON = "json"
+)
+
 // Option 选项方法
 type Option func(*Options)
 
@@ -52,6 +72,7 @@ func NewOptions(opts ...Option) Options {
 		MaxSize:    100,
 		MaxBackups: 3,
 		Compress:   true,
+		Encoding:   EncodingConsole,
 	}
 	for _, opt := range opts {
 		opt(&options)
@@ -73,6 +94,13 @@ func WithFileName(filename string) Option {
 	}
 }
 
+// WithEncoding 暴露接口返回修改日志编码格式的函数, 可选 EncodingConsole、EncodingJSON
+func WithEncoding(encoding string) Option {
+	return func(o *Options) {
+		o.Encoding = encoding
+	}
+}
+
 // Levels zapcore level
 var Levels = map[string]zapcore.Level{
 	"":      zapcore.DebugLevel,
@@ -88,10 +116,27 @@ type zapLoggerWrapper struct {
 	options Options
 }
 
-func newSugarLogger(options Options) *zapLoggerWrapper {
+// NewStdoutLogger 构造输出到标准输出的日志实现
+func NewStdoutLogger(opts ...Option) Logger {
+	options := NewOptions(opts...)
+	return newSugarLogger(options, zapcore.Lock(os.Stdout))
+}
+
+// NewFileLogger 构造输出到日志文件的日志实现, 日志文件由 lumberjack 负责切割, 文件名通过 WithFileName 设置
+func NewFileLogger(opts ...Option) Logger {
+	options := NewOptions(opts...)
+	return newSugarLogger(options, zapcore.AddSync(&lumberjack.Logger{
+		Filename:   options.FileName,
+		MaxAge:     options.MaxAge,
+		MaxSize:    options.MaxSize,
+		MaxBackups: options.MaxBackups,
+		Compress:   options.Compress,
+	}))
+}
+
+func newSugarLogger(options Options, writeSyncer zapcore.WriteSyncer) *zapLoggerWrapper {
 	w := &zapLoggerWrapper{options: options}
 	encoder := w.getEncoder()
-	writeSyncer := w.getLogWriter()
 	core := zapcore.NewCore(encoder, writeSyncer, Levels[options.LogLevel])
 	w.SugaredLogger = zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1)).Sugar()
 	return w
@@ -103,25 +148,64 @@ func (w *zapLoggerWrapper) getEncoder() zapcore.Encoder {
 
 	// 在日志文件中使用大写字母记录日志级别
 	encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	if w.options.Encoding == EncodingJSON {
+		return zapcore.NewJSONEncoder(encoderConfig)
+	}
 	// NewConsoleEncoder 打印更符合人们观察的方式
 	return zapcore.NewConsoleEncoder(encoderConfig)
 }
 
-func (w *zapLoggerWrapper) getLogWriter() zapcore.WriteSyncer {
-	return zapcore.AddSync(&lumberjack.Logger{
-		Filename:   w.options.FileName,
-		MaxAge:     w.options.MaxAge,
-		MaxSize:    w.options.MaxSize,
-		MaxBackups: w.options.MaxBackups,
-		Compress:   w.options.Compress,
-	})
+// With 返回携带了额外字段的日志实现
+func (w *zapLoggerWrapper) With(keysAndValues ...interface{}) StructuredLogger {
+	return &zapLoggerWrapper{
+		SugaredLogger: w.SugaredLogger.With(keysAndValues...),
+		options:       w.options,
+	}
+}
+
+// nopLogger 丢弃所有日志的日志实现
+type nopLogger struct{}
+
+// NewNopLogger 构造丢弃所有日志的日志实现
+func NewNopLogger() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Error(v ...interface{})                 {}
+func (nopLogger) Warn(v ...interface{})                  {}
+func (nopLogger) Info(v ...interface{})                  {}
+func (nopLogger) Debug(v ...interface{})                 {}
+func (nopLogger) Errorf(format string, v ...interface{}) {}
+func (nopLogger) Warnf(format string, v ...interface{})  {}
+func (nopLogger) Infof(format string, v ...interface{})  {}
+func (nopLogger) Debugf(format string, v ...interface{}) {}
+
+func (nopLogger) Errorw(msg string, keysAndValues ...interface{}) {}
+func (nopLogger) Warnw(msg string, keysAndValues ...interface{})  {}
+func (nopLogger) Infow(msg string, keysAndValues ...interface{})  {}
+func (nopLogger) Debugw(msg string, keysAndValues ...interface{}) {}
+
+func (n nopLogger) With(keysAndValues ...interface{}) StructuredLogger {
+	return n
 }
 
 // GetDefaultLogger 获取默认日志实现
 func GetDefaultLogger() Logger {
+	mux.RLock()
+	defer mux.RUnlock()
 	return defaultLogger
 }
 
+// SetDefaultLogger 替换默认日志实现, logger 为 nil 时不做替换
+func SetDefaultLogger(logger Logger) {
+	if logger == nil {
+		return
+	}
+	mux.Lock()
+	defer mux.Unlock()
+	defaultLogger = logger
+}
+
 // Debugf 打印 Debug 日志
 func Debugf(format string, args ...interface{}) {
 	GetDefaultLogger().Debugf(format, args...)
@@ -144,43 +228,64 @@ func Errorf(format string, args ...interface{}) {
 
 // DebugContext 打印 Debug 日志
 func DebugContext(ctx context.Context, args ...interface{}) {
-	GetDefaultLogger().Debug(args...)
+	ContextLogger(ctx, GetDefaultLogger()).Debug(args...)
 }
 
 // DebugContextf 打印 Debug 日志
 func DebugContextf(ctx context.Context, format string, args ...interface{}) {
-	GetDefaultLogger().Debugf(format, args...)
+	ContextLogger(ctx, GetDefaultLogger()).Debugf(format, args...)
 }
 
 // InfoContext 打印 Info 日志
 func InfoContext(ctx context.Context, args ...interface{}) {
-	GetDefaultLogger().Info(args...)
+	ContextLogger(ctx, GetDefaultLogger()).Info(args...)
 }
 
 // InfoContextf 打印 Info 日志
 func InfoContextf(ctx context.Context, format string, args ...interface{}) {
-	GetDefaultLogger().Infof(format, args...)
+	ContextLogger(ctx, GetDefaultLogger()).Infof(format, args...)
 }
 
 // WarnContext 打印 Warn 日志
 func WarnContext(ctx context.Context, args ...interface{}) {
-	GetDefaultLogger().Warn(args...)
+	ContextLogger(ctx, GetDefaultLogger()).Warn(args...)
 }
 
 // WarnContextf 打印 Warn 日志
 func WarnContextf(ctx context.Context, format string, args ...interface{}) {
-	GetDefaultLogger().Warnf(format, args...)
+	ContextLogger(ctx, GetDefaultLogger()).Warnf(format, args...)
 }
 
 // ErrorContext 打印 Error 日志
 func ErrorContext(ctx context.Context, args ...interface{}) {
-	GetDefaultLogger().Error(args...)
+	ContextLogger(ctx, GetDefaultLogger()).Error(args...)
 }
 
+// ErrorContextf 打印 Error 日志
 func ErrorContextf(ctx context.Context, format string, args ...interface{}) {
-	GetDefaultLogger().Errorf(format, args...)
+	ContextLogger(ctx, GetDefaultLogger()).Errorf(format, args...)
 }
 
 func Fatalf(format string, args ...interface{}) {
 	Errorf(format, args...)
 }
+
+// DebugContextw 打印携带 key/value 字段的 Debug 日志
+func DebugContextw(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	ContextLogger(ctx, GetDefaultLogger()).Debugw(msg, keysAndValues...)
+}
+
+// InfoContextw 打印携带 key/value 字段的 Info 日志
+func InfoContextw(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	ContextLogger(ctx, GetDefaultLogger()).Infow(msg, keysAndValues...)
+}
+
+// WarnContextw 打印携带 key/value 字段的 Warn 日志
+func WarnContextw(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	ContextLogger(ctx, GetDefaultLogger()).Warnw(msg, keysAndValues...)
+}
+
+// ErrorContextw 打印携带 key/value 字段的 Error 日志
+func ErrorContextw(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	ContextLogger(ctx, GetDefaultLogger()).Errorw(msg, keysAndValues...)
+}
@@ -0,0 +1,124 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Test_NoFileByDefault 默认日志实现以及标准输出、空日志实现都不能创建日志文件
+func Test_NoFileByDefault(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(wd)
+	}()
+
+	Errorf("default logger, err: %v", "mock")
+	NewStdoutLogger().Errorf("stdout logger, err: %v", "mock")
+	NewNopLogger().Errorf("nop logger, err: %v", "mock")
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("unexpected file: %s", entry.Name())
+	}
+}
+
+func Test_FileLogger(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "gotcc.log")
+	NewFileLogger(WithFileName(fileName)).Errorf("file logger, err: %v", "mock")
+
+	info, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() == 0 {
+		t.Error("empty log file")
+	}
+}
+
+func Test_SetDefaultLogger(t *testing.T) {
+	origin := GetDefaultLogger()
+	defer SetDefaultLogger(origin)
+
+	nop := NewNopLogger()
+	SetDefaultLogger(nop)
+	if GetDefaultLogger() != nop {
+		t.Error("default logger not replaced")
+	}
+	SetDefaultLogger(nil)
+	if GetDefaultLogger() != nop {
+		t.Error("default logger replaced by nil")
+	}
+}
+
+// recordLogger 仅实现了 Logger 接口, 记录打印的日志内容
+type recordLogger struct {
+	lines []string
+}
+
+func (r *recordLogger) record(v ...interface{}) {
+	r.lines = append(r.lines, fmt.Sprint(v...))
+}
+
+func (r *recordLogger) Error(v ...interface{})                 { r.record(v...) }
+func (r *recordLogger) Warn(v ...interface{})                  { r.record(v...) }
+func (r *recordLogger) Info(v ...interface{})                  { r.record(v...) }
+func (r *recordLogger) Debug(v ...interface{})                 { r.record(v...) }
+func (r *recordLogger) Errorf(format string, v ...interface{}) { r.record(fmt.Sprintf(format, v...)) }
+func (r *recordLogger) Warnf(format string, v ...interface{})  { r.record(fmt.Sprintf(format, v...)) }
+func (r *recordLogger) Infof(format string, v ...interface{})  { r.record(fmt.Sprintf(format, v...)) }
+func (r *recordLogger) Debugf(format string, v ...interface{}) { r.record(fmt.Sprintf(format, v...)) }
+
+func Test_ContextLoggerPlain(t *testing.T) {
+	ctx := WithFields(context.Background(), KeyTXID, "1")
+	ctx = WithFields(ctx, KeyComponentID, "componentA")
+
+	logger := &recordLogger{}
+	ContextLogger(ctx, logger).Errorf("try failed, err: %v", "mock")
+	ContextLogger(ctx, logger).Errorw("try failed", "err", "mock")
+	ContextLogger(context.Background(), logger).Info("no fields")
+
+	want := []string{
+		"try failed, err: mock txID=1 componentID=componentA",
+		"try failed txID=1 componentID=componentA err=mock",
+		"no fields",
+	}
+	if strings.Join(logger.lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("lines: %q, want: %q", logger.lines, want)
+	}
+}
+
+func Test_ContextLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newSugarLogger(NewOptions(WithEncoding(EncodingJSON)), zapcore.AddSync(&buf))
+
+	ctx := WithFields(context.Background(), KeyTXID, "1", KeyAttempt, 2)
+	ContextLogger(ctx, logger).Errorw("try failed", "err", "mock")
+
+	line := make(map[string]interface{})
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("invalid json line: %s, err: %v", buf.String(), err)
+	}
+	for key, want := range map[string]interface{}{"msg": "try failed", KeyTXID: "1", KeyAttempt: float64(2), "err": "mock"} {
+		if line[key] != want {
+			t.Errorf("field: %s, got: %v, want: %v", key, line[key], want)
+		}
+	}
+}
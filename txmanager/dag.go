@@ -0,0 +1,148 @@
+package txmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// 组件依赖关系(DAG)
+// 1. RequestEntity 可以通过 DependsOn 声明当前组件依赖的同一事务中的其他组件
+// 2. Try 阶段: 被依赖组件的 Try 成功后才会执行依赖方的 Try, 无依赖关系的分支之间仍然并发执行
+// 3. Confirm 阶段按照拓扑顺序执行, Cancel 阶段按照拓扑逆序执行
+// 4. 组件在事务日志中按照拓扑顺序持久化, 异步轮询流程同样依据 DependsOn 推进
+
+// sortByDependencies 按照组件间的依赖关系对组件实体进行拓扑排序
+func (c ComponentEntities) sortByDependencies() (ComponentEntities, error) {
+	ids := make([]string, 0, len(c))
+	deps := make([][]string, 0, len(c))
+	for _, entity := range c {
+		ids = append(ids, entity.ID())
+		deps = append(deps, entity.DependsOn)
+	}
+
+	order, err := topoSort(ids, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make(ComponentEntities, 0, len(c))
+	for _, i := range order {
+		sorted = append(sorted, c[i])
+	}
+	return sorted, nil
+}
+
+// sortedComponents 返回按照依赖关系拓扑排序后的事务组件
+func (t *Transaction) sortedComponents() ([]*ComponentTryEntity, error) {
+	ids := make([]string, 0, len(t.Components))
+	deps := make([][]string, 0, len(t.Components))
+	for _, component := range t.Components {
+		ids = append(ids, component.ComponentID)
+		deps = append(deps, component.DependsOn)
+	}
+
+	order, err := topoSort(ids, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]*ComponentTryEntity, 0, len(t.Components))
+	for _, i := range order {
+		sorted = append(sorted, t.Components[i])
+	}
+	return sorted, nil
+}
+
+// topoSort 拓扑排序, 返回排序后的下标
+// 1. 被依赖的组件排在依赖方之前, 无依赖关系的组件之间保持原有的声明顺序
+// 2. 依赖了事务之外的组件, 或者组件之间存在循环依赖时返回错误
+func topoSort(ids []string, deps [][]string) ([]int, error) {
+	idToIndex := make(map[string]int, len(ids))
+	for i, id := range ids {
+		idToIndex[id] = i
+	}
+
+	// 1. 统计各组件的入度以及被依赖关系
+	inDegree := make([]int, len(ids))
+	dependents := make([][]int, len(ids))
+	for i, dependsOn := range deps {
+		for _, dep := range dependsOn {
+			j, ok := idToIndex[dep]
+			if !ok {
+				return nil, fmt.Errorf("component: %s depends on unknown component: %s", ids[i], dep)
+			}
+			if i == j {
+				return nil, fmt.Errorf("component: %s depends on itself", ids[i])
+			}
+			inDegree[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	// 2. 每轮选取声明顺序最靠前的入度为 0 的组件
+	order := make([]int, 0, len(ids))
+	visited := make([]bool, len(ids))
+	for len(order) < len(ids) {
+		next := -1
+		for i := range ids {
+			if !visited[i] && inDegree[i] == 0 {
+				next = i
+				break
+			}
+		}
+		// 2.1 不存在入度为 0 的组件, 说明存在循环依赖
+		if next == -1 {
+			return nil, errors.New("circular dependency between components")
+		}
+
+		visited[next] = true
+		order = append(order, next)
+		for _, dependent := range dependents[next] {
+			inDegree[dependent]--
+		}
+	}
+
+	return order, nil
+}
+
+// tryNode DAG 中单个组件 Try 的执行情况
+type tryNode struct {
+	done      chan struct{} // Try 执行结束后关闭
+	accepted  bool          // Try 是否成功, 需要在 done 关闭之前写入
+	persisted bool          // Try 失败的结果是否已经写入事务日志
+}
+
+// newTryNodes 为事务中的每个组件构造 tryNode
+func newTryNodes(componentEntities ComponentEntities) map[string]*tryNode {
+	nodes := make(map[string]*tryNode, len(componentEntities))
+	for _, componentEntity := range componentEntities {
+		nodes[componentEntity.ID()] = &tryNode{done: make(chan struct{})}
+	}
+	return nodes
+}
+
+// waitDependencies 等待被依赖的组件 Try 结束, 被依赖的组件全部 Try 成功时返回 nil
+func waitDependencies(ctx context.Context, nodes map[string]*tryNode, dependsOn []string) error {
+	for _, dep := range dependsOn {
+		select {
+		case <-nodes[dep].done:
+			if !nodes[dep].accepted {
+				return ErrDependencyRejected
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// dependenciesAccepted 判断被依赖的组件是否全部 Try 成功, 用于异步轮询流程中补发 Try
+func dependenciesAccepted(idToComponent map[string]*ComponentTryEntity, dependsOn []string) bool {
+	for _, dep := range dependsOn {
+		if component, ok := idToComponent[dep]; !ok || component.TryStatus != TrySucceesful {
+			return false
+		}
+	}
+	return true
+}
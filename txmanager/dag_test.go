@@ -0,0 +1,227 @@
+package txmanager
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+// Test_TopoSort 被依赖的组件排在依赖方之前, 依赖关系非法时返回错误
+func Test_TopoSort(t *testing.T) {
+	tests := []struct {
+		name    string
+		ids     []string
+		deps    [][]string
+		want    []int
+		wantErr bool
+	}{
+		{name: "no dependency", ids: []string{"a", "b", "c"}, deps: [][]string{nil, nil, nil}, want: []int{0, 1, 2}},
+		{name: "chain", ids: []string{"c", "b", "a"}, deps: [][]string{{"b"}, {"a"}, nil}, want: []int{2, 1, 0}},
+		{name: "diamond", ids: []string{"d", "b", "c", "a"}, deps: [][]string{{"b", "c"}, {"a"}, {"a"}, nil}, want: []int{3, 1, 2, 0}},
+		{name: "unknown dependency", ids: []string{"a", "b"}, deps: [][]string{nil, {"x"}}, wantErr: true},
+		{name: "self dependency", ids: []string{"a"}, deps: [][]string{{"a"}}, wantErr: true},
+		{name: "cycle", ids: []string{"a", "b", "c"}, deps: [][]string{{"c"}, {"a"}, {"b"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := topoSort(tt.ids, tt.deps)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err: %v, want err: %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order: %v, want: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// dagRecorder 按照调用顺序记录各组件每个阶段的执行情况
+type dagRecorder struct {
+	mux   sync.Mutex
+	calls map[Phase][]string
+}
+
+func (d *dagRecorder) record(phase Phase, id string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if d.calls == nil {
+		d.calls = make(map[Phase][]string)
+	}
+	d.calls[phase] = append(d.calls[phase], id)
+}
+
+func (d *dagRecorder) called(phase Phase) []string {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return append([]string(nil), d.calls[phase]...)
+}
+
+// dagComponent 记录调用顺序的 TCC 组件, Try 执行前会先调用 before
+type dagComponent struct {
+	id       string
+	ack      bool
+	before   func()
+	recorder *dagRecorder
+}
+
+func (d *dagComponent) ID() string {
+	return d.id
+}
+
+func (d *dagComponent) Try(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+	if d.before != nil {
+		d.before()
+	}
+	d.recorder.record(PhaseTry, d.id)
+	return &component.TCCResp{ComponentID: d.id, TXID: req.TXID, ACK: d.ack}, nil
+}
+
+func (d *dagComponent) Confirm(ctx context.Context, txID string) (*component.TCCResp, error) {
+	d.recorder.record(PhaseConfirm, d.id)
+	return &component.TCCResp{ComponentID: d.id, TXID: txID, ACK: true}, nil
+}
+
+func (d *dagComponent) Cancel(ctx context.Context, txID string) (*component.TCCResp, error) {
+	d.recorder.record(PhaseCancel, d.id)
+	return &component.TCCResp{ComponentID: d.id, TXID: txID, ACK: true}, nil
+}
+
+func newDAGManager(t *testing.T, components ...*dagComponent) *TXManager {
+	txManager := NewTXManager(NewMemTXStore(), WithMonitorTick(time.Hour), WithSecondPhase(SecondPhaseSync), WithLogger(log.NewNopLogger()))
+	for _, c := range components {
+		if err := txManager.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return txManager
+}
+
+// Test_DAGOrder Try 与 Confirm 按照拓扑顺序执行, Cancel 按照拓扑逆序执行
+func Test_DAGOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		rejected    string
+		status      TXStatus
+		wantTry     []string
+		wantConfirm []string
+		wantCancel  []string
+	}{
+		{name: "confirm", status: TXSuccessful, wantTry: []string{"a", "b", "c"}, wantConfirm: []string{"a", "b", "c"}},
+		{name: "cancel", rejected: "c", status: TXFailure, wantTry: []string{"a", "b", "c"}, wantCancel: []string{"c", "b", "a"}},
+		// 被依赖的组件 Try 失败时, 依赖方不再执行 Try
+		{name: "dependency rejected", rejected: "b", status: TXFailure, wantTry: []string{"a", "b"}, wantCancel: []string{"c", "b", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &dagRecorder{}
+			components := make([]*dagComponent, 0, 3)
+			for _, id := range []string{"a", "b", "c"} {
+				components = append(components, &dagComponent{id: id, ack: id != tt.rejected, recorder: recorder})
+			}
+			txManager := newDAGManager(t, components...)
+			defer txManager.Stop()
+
+			// 声明顺序与依赖顺序相反: c 依赖 b, b 依赖 a
+			result, err := txManager.Execute(context.Background(),
+				&RequestEntity{ComponentID: "c", DependsOn: []string{"b"}},
+				&RequestEntity{ComponentID: "b", DependsOn: []string{"a"}},
+				&RequestEntity{ComponentID: "a"},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Status != tt.status || !result.Finalized {
+				t.Errorf("tx status: %s, finalized: %t, want: %s", result.Status, result.Finalized, tt.status)
+			}
+			if got := recorder.called(PhaseTry); !reflect.DeepEqual(got, tt.wantTry) {
+				t.Errorf("try order: %v, want: %v", got, tt.wantTry)
+			}
+			if got := recorder.called(PhaseConfirm); !reflect.DeepEqual(got, tt.wantConfirm) {
+				t.Errorf("confirm order: %v, want: %v", got, tt.wantConfirm)
+			}
+			if got := recorder.called(PhaseCancel); !reflect.DeepEqual(got, tt.wantCancel) {
+				t.Errorf("cancel order: %v, want: %v", got, tt.wantCancel)
+			}
+		})
+	}
+}
+
+// Test_DAGParallel 无依赖关系的分支之间并发执行 Try
+func Test_DAGParallel(t *testing.T) {
+	// x 与 y 的 Try 必须同时处于执行中才能通过屏障, 串行执行时会等待超时
+	var wg sync.WaitGroup
+	wg.Add(2)
+	arrived := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(arrived)
+	}()
+	barrier := func() {
+		wg.Done()
+		select {
+		case <-arrived:
+		case <-time.After(time.Second):
+			t.Error("independent branches are not tried concurrently")
+		}
+	}
+
+	recorder := &dagRecorder{}
+	txManager := newDAGManager(t,
+		&dagComponent{id: "root", ack: true, recorder: recorder},
+		&dagComponent{id: "x", ack: true, before: barrier, recorder: recorder},
+		&dagComponent{id: "y", ack: true, before: barrier, recorder: recorder},
+		&dagComponent{id: "join", ack: true, recorder: recorder},
+	)
+	defer txManager.Stop()
+
+	result, err := txManager.Execute(context.Background(),
+		&RequestEntity{ComponentID: "join", DependsOn: []string{"x", "y"}},
+		&RequestEntity{ComponentID: "x", DependsOn: []string{"root"}},
+		&RequestEntity{ComponentID: "y", DependsOn: []string{"root"}},
+		&RequestEntity{ComponentID: "root"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Successful() {
+		t.Errorf("tx status: %s, want: %s", result.Status, TXSuccessful)
+	}
+	tries := recorder.called(PhaseTry)
+	if len(tries) != 4 || tries[0] != "root" || tries[3] != "join" {
+		t.Errorf("try order: %v, want root first and join last", tries)
+	}
+}
+
+// Test_DAGInvalidDependencies 依赖关系非法时不会创建事务
+func Test_DAGInvalidDependencies(t *testing.T) {
+	recorder := &dagRecorder{}
+	txManager := newDAGManager(t,
+		&dagComponent{id: "a", ack: true, recorder: recorder},
+		&dagComponent{id: "b", ack: true, recorder: recorder},
+	)
+	defer txManager.Stop()
+
+	tests := []struct {
+		name string
+		reqs []*RequestEntity
+	}{
+		{name: "unknown dependency", reqs: []*RequestEntity{{ComponentID: "a", DependsOn: []string{"x"}}}},
+		{name: "self dependency", reqs: []*RequestEntity{{ComponentID: "a", DependsOn: []string{"a"}}}},
+		{name: "cycle", reqs: []*RequestEntity{{ComponentID: "a", DependsOn: []string{"b"}}, {ComponentID: "b", DependsOn: []string{"a"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := txManager.Execute(context.Background(), tt.reqs...); err == nil {
+				t.Error("want error, got nil")
+			}
+		})
+	}
+	if tries := recorder.called(PhaseTry); len(tries) != 0 {
+		t.Errorf("tries: %v, want none", tries)
+	}
+}
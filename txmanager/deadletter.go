@@ -0,0 +1,74 @@
+package txmanager
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// 单笔事务的重试与 dead letter
+// 1. 推进事务第二阶段失败(组件调用出错、拒绝 confirm/cancel 请求或者提交最终状态失败)时, 累计失败次数,
+//    按照指数退避计算下一次重试的时间, 并通过 TXStore.TXRetry 随事务日志持久化
+// 2. 异步轮询流程跳过尚未到达重试时间的事务, 单笔事务的失败不再拉长整体的轮询间隔
+// 3. 失败次数达到 MaxRecoveryAttempts 后, 事务被置为 dead_letter 终态并记录最后一次失败的原因, 等待人工介入
+// 4. 租约丢失、TXManager 停止或者同步执行第二阶段超过截止时间导致的失败与事务本身无关, 不计入失败次数
+
+// recoveryBackoff 返回事务第 attempts 次推进失败后的重试间隔
+func (t *TXManager) recoveryBackoff(attempts int) time.Duration {
+	backoff := t.opts.RecoveryBackoff
+	for i := 1; i < attempts && backoff < t.opts.MaxRecoveryBackoff; i++ {
+		backoff <<= 1
+	}
+	if backoff > t.opts.MaxRecoveryBackoff {
+		backoff = t.opts.MaxRecoveryBackoff
+	}
+	return backoff
+}
+
+// recordFailure 记录一次推进事务失败的结果
+func (t *TXManager) recordFailure(ctx context.Context, tx *Transaction, cause error) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	attempts, lastErr := tx.Attempts+1, cause.Error()
+	// 人工介入 dead_letter 状态的事务再次失败时, 仅更新失败原因
+	if tx.Status == TXDeadLetter {
+		if err := t.txStore.TXDeadLetter(ctx, tx.TXID, lastErr); err != nil {
+			t.logger(ctx).Warnw("record dead letter tx failure failed", "err", err)
+		}
+		tx.LastError = lastErr
+		return
+	}
+	if max := t.opts.MaxRecoveryAttempts; max > 0 && attempts >= max {
+		if err := t.deadLetter(ctx, tx, attempts, lastErr); err != nil {
+			t.logger(ctx).Warnw("dead letter tx failed", "attempts", attempts, "err", err)
+		}
+		return
+	}
+
+	nextRetryAt := time.Now().Add(t.recoveryBackoff(attempts))
+	if err := t.txStore.TXRetry(ctx, tx.TXID, attempts, nextRetryAt, lastErr); err != nil {
+		t.logger(ctx).Warnw("record tx retry failed", "attempts", attempts, "err", err)
+		return
+	}
+	tx.Attempts, tx.NextRetryAt, tx.LastError = attempts, nextRetryAt, lastErr
+}
+
+// deadLetter 将事务置为 dead_letter 终态, 上报事务结果、投递 EventTXFinalized 事件并唤醒等待该事务的句柄
+func (t *TXManager) deadLetter(ctx context.Context, tx *Transaction, attempts int, lastErr string) error {
+	if err := t.txStore.TXDeadLetter(ctx, tx.TXID, lastErr); err != nil {
+		return err
+	}
+	tx.Status, tx.Attempts, tx.LastError = TXDeadLetter, attempts, lastErr
+
+	mode := tx.Mode
+	if mode == "" {
+		mode = TXModeTCC
+	}
+	t.logger(ctx).Errorw("tx dead lettered, needs manual intervention", "attempts", attempts, "err", lastErr)
+	t.opts.Metrics.TXFinished(mode, TXDeadLetter, false)
+	t.emit(ctx, &Event{Type: EventTXFinalized, TXID: tx.TXID, Mode: mode, Status: TXDeadLetter, Err: errors.New(lastErr)})
+	t.waiters.notify(tx.TXID)
+	return nil
+}
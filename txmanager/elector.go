@@ -0,0 +1,148 @@
+package txmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 异步轮询流程的选主
+// 1. 多个 TX Manager 节点通过 Elector 竞争 leader 身份, 只有持有租约的 leader 节点才会执行异步轮询流程
+// 2. leader 在后台按照 LeaseTTL/3 的间隔续约, 推进事务的耗时不再受限于单次加锁的过期时间
+// 3. 续约失败(租约丢失)时, leader 立即终止正在执行的推进流程并退位, 之后重新参与选主
+// 4. 每次易主时租约的 fencing token 单调递增, 异步轮询流程访问 TXStore 时 ctx 中携带当前的 token,
+//    TXStore 的实现通过 CheckFencingToken 拒绝携带过期 token 的写操作, 避免旧 leader 在退位前的写入覆盖新 leader 的结果
+//    token 在事务维度比较, 更换选主模块(例如开启分片恢复模式)时需要保证新选主模块生成的 token 大于此前的 token
+
+var (
+	// ErrNotLeader 其他节点持有未过期的租约
+	ErrNotLeader = errors.New("not leader")
+	// ErrLeaseLost 租约已经过期或者被其他节点取得
+	ErrLeaseLost = errors.New("lease lost")
+	// ErrStaleToken 写操作携带的 fencing token 小于事务已经接受过的 token, 发起写操作的 leader 已经退位
+	ErrStaleToken = errors.New("stale fencing token")
+)
+
+// Lease leader 租约
+type Lease struct {
+	// fencing token, 每次易主时单调递增, 同时作为租约的唯一标识
+	Token int64
+	// 租约的过期时间
+	ExpireAt time.Time
+}
+
+// Elector 选主模块
+type Elector interface {
+	// Acquire 竞争 leader 身份, 取得时返回有效期为 ttl 的租约, 其他节点持有未过期的租约时返回 ErrNotLeader
+	Acquire(ctx context.Context, ttl time.Duration) (*Lease, error)
+	// Renew 续约, 返回有效期为 ttl 的新租约, fencing token 保持不变. 租约已经丢失时返回 ErrLeaseLost
+	Renew(ctx context.Context, lease *Lease, ttl time.Duration) (*Lease, error)
+	// Resign 主动放弃 leader 身份, 便于其他节点尽快接管
+	Resign(ctx context.Context, lease *Lease) error
+}
+
+type fencingTokenKey struct{}
+
+// WithFencingToken 返回携带了 fencing token 的 context, 由 leader 的轮询任务使用, 也便于 TXStore 的实现在单测中模拟新旧 leader 的写入
+func WithFencingToken(ctx context.Context, token int64) context.Context {
+	return context.WithValue(ctx, fencingTokenKey{}, token)
+}
+
+// FencingToken 返回异步轮询流程访问 TXStore 时 ctx 中携带的 fencing token, 非异步轮询流程的调用返回 false
+func FencingToken(ctx context.Context) (int64, bool) {
+	token, ok := ctx.Value(fencingTokenKey{}).(int64)
+	return token, ok
+}
+
+// CheckFencingToken 供 TXStore 的实现在写操作中校验 ctx 中携带的 fencing token
+// 1. accepted 为该笔事务已经接受过的最大 token, 返回写入成功后需要与事务一并持久化的 token
+// 2. token 小于 accepted 时返回 ErrStaleToken, 校验与写入需要在同一个原子操作中完成(例如持有行锁或者条件更新)
+// 3. 未携带 token 的写操作(第一阶段、运维接口)不做校验, 原样返回 accepted
+func CheckFencingToken(ctx context.Context, accepted int64) (int64, error) {
+	token, ok := FencingToken(ctx)
+	if !ok {
+		return accepted, nil
+	}
+	if token < accepted {
+		return accepted, fmt.Errorf("%w, token: %d, accepted: %d", ErrStaleToken, token, accepted)
+	}
+	return token, nil
+}
+
+// MemElector 基于内存实现的选主模块, 适用于单测以及单进程内的多个 TXManager 共享
+type MemElector struct {
+	mux   sync.Mutex
+	lease Lease
+}
+
+// NewMemElector 构造基于内存实现的选主模块
+func NewMemElector() *MemElector {
+	return &MemElector{}
+}
+
+func (m *MemElector) Acquire(ctx context.Context, ttl time.Duration) (*Lease, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	now := time.Now()
+	if now.Before(m.lease.ExpireAt) {
+		return nil, ErrNotLeader
+	}
+	m.lease = Lease{Token: m.lease.Token + 1, ExpireAt: now.Add(ttl)}
+	lease := m.lease
+	return &lease, nil
+}
+
+func (m *MemElector) Renew(ctx context.Context, lease *Lease, ttl time.Duration) (*Lease, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	now := time.Now()
+	if m.lease.Token != lease.Token || !now.Before(m.lease.ExpireAt) {
+		return nil, ErrLeaseLost
+	}
+	m.lease.ExpireAt = now.Add(ttl)
+	renewed := m.lease
+	return &renewed, nil
+}
+
+func (m *MemElector) Resign(ctx context.Context, lease *Lease) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.lease.Token != lease.Token {
+		return ErrLeaseLost
+	}
+	m.lease.ExpireAt = time.Time{}
+	return nil
+}
+
+// txStoreElector 基于 TXStore 分布式锁实现的选主模块, 是未注入 Elector 时的默认实现
+// 1. fencing token 由 TXStore.Lock 基于存储侧的计数器生成, 多个节点之间单调递增
+// 2. 续约通过 TXStore.RenewLock 原子地校验锁的持有者并延长过期时间, 不存在先解锁再加锁的空窗期
+type txStoreElector struct {
+	txStore TXStore
+}
+
+func (t *txStoreElector) Acquire(ctx context.Context, ttl time.Duration) (*Lease, error) {
+	now := time.Now()
+	token, err := t.txStore.Lock(ctx, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("%w, err: %v", ErrNotLeader, err)
+	}
+	return &Lease{Token: token, ExpireAt: now.Add(ttl)}, nil
+}
+
+func (t *txStoreElector) Renew(ctx context.Context, lease *Lease, ttl time.Duration) (*Lease, error) {
+	now := time.Now()
+	if err := t.txStore.RenewLock(ctx, lease.Token, ttl); err != nil {
+		return nil, fmt.Errorf("%w, err: %v", ErrLeaseLost, err)
+	}
+	return &Lease{Token: lease.Token, ExpireAt: now.Add(ttl)}, nil
+}
+
+func (t *txStoreElector) Resign(ctx context.Context, lease *Lease) error {
+	return t.txStore.Unlock(ctx, lease.Token)
+}
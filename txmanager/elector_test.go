@@ -0,0 +1,203 @@
+package txmanager
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+func Test_MemElector(t *testing.T) {
+	ctx := context.Background()
+	elector := NewMemElector()
+
+	lease, err := elector.Acquire(ctx, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = elector.Acquire(ctx, 50*time.Millisecond); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("acquire err: %v, want: %v", err, ErrNotLeader)
+	}
+	renewed, err := elector.Renew(ctx, lease, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed.Token != lease.Token {
+		t.Errorf("renewed token: %d, want: %d", renewed.Token, lease.Token)
+	}
+
+	// 租约过期后其他节点取得新租约, fencing token 递增, 旧租约无法续约
+	time.Sleep(60 * time.Millisecond)
+	next, err := elector.Acquire(ctx, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Token <= lease.Token {
+		t.Errorf("next token: %d, want greater than: %d", next.Token, lease.Token)
+	}
+	if _, err = elector.Renew(ctx, lease, time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("renew err: %v, want: %v", err, ErrLeaseLost)
+	}
+
+	// 主动放弃后其他节点可以立即取得租约
+	if err = elector.Resign(ctx, next); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = elector.Acquire(ctx, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test_TXStoreElector 默认的选主模块基于 TXStore 的分布式锁续约, fencing token 由 TXStore 生成并在易主时递增
+func Test_TXStoreElector(t *testing.T) {
+	ctx := context.Background()
+	txStore := NewMemTXStore()
+	elector, other := &txStoreElector{txStore: txStore}, &txStoreElector{txStore: txStore}
+
+	lease, err := elector.Acquire(ctx, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if lease, err = elector.Renew(ctx, lease, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	// 续约后超过初始的过期时间, 其他节点仍然无法取得租约
+	time.Sleep(30 * time.Millisecond)
+	if _, err = other.Acquire(ctx, time.Minute); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("acquire err: %v, want: %v", err, ErrNotLeader)
+	}
+
+	// 租约过期后其他节点取得新租约, 旧租约无法续约, 也无法释放新租约
+	time.Sleep(60 * time.Millisecond)
+	next, err := other.Acquire(ctx, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Token <= lease.Token {
+		t.Errorf("next token: %d, want greater than: %d", next.Token, lease.Token)
+	}
+	if _, err = elector.Renew(ctx, lease, time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("renew err: %v, want: %v", err, ErrLeaseLost)
+	}
+	_ = elector.Resign(ctx, lease)
+	if _, err = elector.Acquire(ctx, time.Minute); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("acquire after stale resign err: %v, want: %v", err, ErrNotLeader)
+	}
+}
+
+// Test_ElectorSingleLeader 多个节点中只有 leader 执行异步轮询流程, 且 leader 通过续约持续保有租约
+func Test_ElectorSingleLeader(t *testing.T) {
+	txStore, elector := NewMemTXStore(), NewMemElector()
+	metrics := []*recordMetrics{newRecordMetrics(), newRecordMetrics()}
+	for _, m := range metrics {
+		txManager := NewTXManager(txStore, WithMonitorTick(10*time.Millisecond), WithLeaseTTL(90*time.Millisecond),
+			WithElector(elector), WithMetrics(m), WithLogger(log.NewNopLogger()))
+		defer txManager.Stop()
+	}
+
+	// 等待多个租约周期
+	time.Sleep(300 * time.Millisecond)
+	var leaders int
+	for _, m := range metrics {
+		if m.get("recovery_tick") > m.get("recovery_lock_failed") {
+			leaders++
+			if m.get("recovery_lock_failed") > 0 {
+				t.Errorf("leader lost lease, lock failed: %d", m.get("recovery_lock_failed"))
+			}
+		}
+	}
+	if leaders != 1 {
+		t.Errorf("leaders: %d, want: 1", leaders)
+	}
+}
+
+// blockingConfirmComponent confirm 请求阻塞直到 ctx 终止, 并记录 ctx 中的 fencing token 以及终止原因
+type blockingConfirmComponent struct {
+	mockComponent
+	tokens chan int64
+	errs   chan error
+}
+
+func (b *blockingConfirmComponent) Confirm(ctx context.Context, txID string) (*component.TCCResp, error) {
+	token, _ := FencingToken(ctx)
+	b.tokens <- token
+	<-ctx.Done()
+	b.errs <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+// Test_ElectorStepDown 租约丢失时 leader 立即终止正在执行的推进流程
+func Test_ElectorStepDown(t *testing.T) {
+	txStore, elector := NewMemTXStore(), NewMemElector()
+	txManager := NewTXManager(txStore, WithMonitorTick(10*time.Millisecond), WithLeaseTTL(60*time.Millisecond),
+		WithElector(elector), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+
+	c := &blockingConfirmComponent{mockComponent: mockComponent{id: "blocking", ack: true}, tokens: make(chan int64, 16), errs: make(chan error, 16)}
+	if err := txManager.Register(c, WithConfirmTimeout(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	txID, err := txStore.CreateTX(ctx, NewTransaction(ComponentEntities{{Component: c}}, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = txStore.TXUpdate(ctx, txID, c.ID(), true); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1. leader 推进 confirm 时 ctx 中携带 fencing token
+	var token int64
+	select {
+	case token = <-c.tokens:
+	case <-time.After(2 * time.Second):
+		t.Fatal("confirm not called")
+	}
+	if token != 1 {
+		t.Errorf("fencing token: %d, want: 1", token)
+	}
+
+	// 2. 模拟其他节点取得租约, leader 续约失败后终止推进流程
+	elector.mux.Lock()
+	elector.lease = Lease{Token: elector.lease.Token + 1, ExpireAt: time.Now().Add(time.Hour)}
+	elector.mux.Unlock()
+	select {
+	case err = <-c.errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("confirm ctx err: %v, want: %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("leader not stepped down")
+	}
+}
+
+// failingTXStore 获取 hanging 事务始终失败的事务日志存储模块, 记录调用次数
+type failingTXStore struct {
+	*MemTXStore
+	calls int32
+}
+
+func (f *failingTXStore) GetHangingTXs(ctx context.Context, query HangingQuery) ([]*Transaction, string, error) {
+	atomic.AddInt32(&f.calls, 1)
+	return nil, "", errors.New("store unavailable")
+}
+
+// Test_LeaderBackOff 获取事务持续失败时 leader 按照退避策略放缓轮询, 而不是空转
+func Test_LeaderBackOff(t *testing.T) {
+	const tick = 10 * time.Millisecond
+	txStore := &failingTXStore{MemTXStore: NewMemTXStore()}
+	txManager := NewTXManager(txStore, WithMonitorTick(tick), WithLogger(log.NewNopLogger()))
+	time.Sleep(300 * time.Millisecond)
+	txManager.Stop()
+
+	// 轮询间隔不小于 tick, 且失败后逐步翻倍至 8 倍 tick
+	calls := atomic.LoadInt32(&txStore.calls)
+	if calls == 0 || calls > int32(300*time.Millisecond/tick) {
+		t.Errorf("get hanging txs calls: %d, want between 1 and %d", calls, 300*time.Millisecond/tick)
+	}
+}
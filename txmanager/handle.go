@@ -0,0 +1,173 @@
+package txmanager
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+// 异步提交事务
+// 1. Submit 在事务明细记录持久化之后立即返回事务句柄, 第一阶段在后台 goroutine 中执行, 第二阶段与 Execute 一样由 advanceProgressByTXID 异步推进
+// 2. 通过句柄的 Wait 可以阻塞等待事务的最终状态(第二阶段 confirm/cancel 全部完成并提交), Poll 则返回事务当前的状态
+// 3. 任意节点都可以通过 Handle 基于事务 id 获取句柄, 事务的状态以 TXStore 中的事务日志为准
+
+// TXHandle 异步提交的事务句柄
+type TXHandle struct {
+	txID      string
+	txManager *TXManager
+	// 本节点异步执行第一阶段时, 第一阶段结束后关闭. 通过 Handle 获取的句柄为 nil
+	firstPhase chan struct{}
+	// 本节点第一阶段的执行结果, firstPhase 关闭后可读
+	result *TXResult
+}
+
+// Submit 异步启动分布式事务, 事务明细记录持久化之后立即返回事务句柄
+// 第一阶段不受 ctx 终止的影响, 但仍需要在事务的截止时间之前完成, TXManager 停止时尚未完成的事务由异步轮询流程兜底
+func (t *TXManager) Submit(ctx context.Context, reqs []*RequestEntity, opts ...TXOption) (*TXHandle, error) {
+	txID, commit, err := t.prepare(ctx, reqs, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	handle := &TXHandle{
+		txID:       txID,
+		txManager:  t,
+		firstPhase: make(chan struct{}),
+	}
+	// 第一阶段的生命周期与 TXManager 绑定, 不随调用方的 ctx 终止, 日志字段保持不变
+	cctx := log.WithFields(t.ctx, log.Fields(ctx)...)
+	go func() {
+		defer close(handle.firstPhase)
+		handle.result = commit(cctx)
+	}()
+	return handle, nil
+}
+
+// Handle 根据事务 id 获取事务句柄, 用于查询或者等待任意节点创建的事务
+func (t *TXManager) Handle(txID string) *TXHandle {
+	return &TXHandle{
+		txID:      txID,
+		txManager: t,
+	}
+}
+
+// TXID 返回全局唯一的事务 id
+func (h *TXHandle) TXID() string {
+	return h.txID
+}
+
+// Poll 返回事务当前的状态, 事务的最终状态尚未提交时 Status 为 hanging
+// 本节点第一阶段已经结束时, 返回结果中携带各组件第一阶段的执行结果以及失败原因
+func (h *TXHandle) Poll(ctx context.Context) (*TXResult, error) {
+	tx, err := h.txManager.txStore.GetTX(ctx, h.txID)
+	if err != nil {
+		return nil, err
+	}
+
+	if result := h.firstPhaseResult(); result != nil {
+		return &TXResult{TXID: h.txID, Status: tx.Status, Components: result.Components}, nil
+	}
+	components := make([]*ComponentResult, 0, len(tx.Components))
+	for _, component := range tx.Components {
+		components = append(components, &ComponentResult{
+			ComponentID: component.ComponentID,
+			TryStatus:   component.TryStatus,
+		})
+	}
+	return &TXResult{TXID: h.txID, Status: tx.Status, Components: components}, nil
+}
+
+// Wait 阻塞直到事务的最终状态提交成功(第二阶段 confirm/cancel 全部执行完成)、事务被置为 dead_letter 状态或者 ctx 终止
+//  1. 事务由本节点推进时, 提交后立即唤醒
+//  2. 事务由其他节点推进时, 按照退避策略轮询事务日志, 轮询间隔封顶为 TXManager 的 MonitorTick
+func (h *TXHandle) Wait(ctx context.Context) (*TXResult, error) {
+	if h.firstPhase != nil {
+		select {
+		case <-h.firstPhase:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	interval := 10 * time.Millisecond
+	for {
+		// 先注册再查询, 避免错过查询与注册之间的提交
+		finalized, release := h.txManager.waiters.add(h.txID)
+		result, err := h.Poll(ctx)
+		if err == nil && result.Status != TXHanging {
+			release()
+			return result, nil
+		}
+		if err != nil {
+			h.txManager.logger(ctx).Warnw("poll tx failed", log.KeyTXID, h.txID, "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		case <-finalized:
+		case <-time.After(interval):
+		}
+		release()
+		if interval <<= 1; interval > h.txManager.opts.MonitorTick {
+			interval = h.txManager.opts.MonitorTick
+		}
+	}
+}
+
+// firstPhaseResult 返回本节点第一阶段的执行结果, 尚未结束或者不是本节点执行时返回 nil
+func (h *TXHandle) firstPhaseResult() *TXResult {
+	if h.firstPhase == nil {
+		return nil
+	}
+	select {
+	case <-h.firstPhase:
+		return h.result
+	default:
+		return nil
+	}
+}
+
+// waiters 管理等待事务最终状态提交的句柄, 本节点提交事务的最终状态后唤醒对应的句柄
+type waiters struct {
+	mux sync.Mutex
+	chs map[string]map[chan struct{}]struct{}
+}
+
+func newWaiters() *waiters {
+	return &waiters{chs: make(map[string]map[chan struct{}]struct{})}
+}
+
+// add 注册等待事务 txID 的 channel, 等待结束后需要调用 release 注销
+func (w *waiters) add(txID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{})
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.chs[txID] == nil {
+		w.chs[txID] = make(map[chan struct{}]struct{})
+	}
+	w.chs[txID][ch] = struct{}{}
+	return ch, func() {
+		w.mux.Lock()
+		defer w.mux.Unlock()
+		if chs, ok := w.chs[txID]; ok {
+			delete(chs, ch)
+			if len(chs) == 0 {
+				delete(w.chs, txID)
+			}
+		}
+	}
+}
+
+// notify 唤醒所有等待事务 txID 的句柄
+func (w *waiters) notify(txID string) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	for ch := range w.chs[txID] {
+		close(ch)
+	}
+	delete(w.chs, txID)
+}
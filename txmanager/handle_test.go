@@ -0,0 +1,132 @@
+package txmanager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+// blockingComponent try 请求阻塞直到 release 关闭的 TCC 组件
+type blockingComponent struct {
+	mockComponent
+	release chan struct{}
+}
+
+func (b *blockingComponent) Try(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return b.mockComponent.Try(ctx, req)
+}
+
+func Test_Submit(t *testing.T) {
+	txStore := NewMemTXStore()
+	txManager := NewTXManager(txStore, WithMonitorTick(time.Hour), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+
+	c := &blockingComponent{mockComponent: mockComponent{id: "blocking", ack: true}, release: make(chan struct{})}
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1. try 阻塞时 Submit 仍然立即返回
+	ctx, cancel := context.WithCancel(context.Background())
+	handle, err := txManager.Submit(ctx, []*RequestEntity{{ComponentID: c.ID()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 调用方 ctx 终止不影响异步执行的第一阶段
+	cancel()
+	result, err := handle.Poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != TXHanging {
+		t.Errorf("tx status: %s, want: %s", result.Status, TXHanging)
+	}
+
+	// 2. 等待超时
+	wctx, wcancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer wcancel()
+	if _, err = handle.Wait(wctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wait err: %v, want: %v", err, context.DeadlineExceeded)
+	}
+
+	// 3. try 完成后等待 confirm 执行完成并提交事务
+	close(c.release)
+	if result, err = handle.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if result.TXID != handle.TXID() || result.Status != TXSuccessful {
+		t.Errorf("tx: %s status: %s, want tx: %s status: %s", result.TXID, result.Status, handle.TXID(), TXSuccessful)
+	}
+	tx, err := txStore.GetTX(context.Background(), handle.TXID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Status != TXSuccessful {
+		t.Errorf("stored tx status: %s, want: %s", tx.Status, TXSuccessful)
+	}
+}
+
+func Test_SubmitFailure(t *testing.T) {
+	txManager := NewTXManager(NewMemTXStore(), WithMonitorTick(time.Hour), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+
+	c := &mockComponent{id: "rejected"}
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	handle, err := txManager.Submit(context.Background(), []*RequestEntity{{ComponentID: c.ID()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := handle.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != TXFailure {
+		t.Errorf("tx status: %s, want: %s", result.Status, TXFailure)
+	}
+	// 本节点执行的第一阶段保留了组件失败的原因
+	if result.Err() == nil {
+		t.Error("component err not kept")
+	}
+}
+
+// Test_HandleByTXID 其他节点基于事务 id 等待事务的最终状态
+func Test_HandleByTXID(t *testing.T) {
+	txStore := NewMemTXStore()
+	txManager := NewTXManager(txStore, WithMonitorTick(time.Hour), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+	other := NewTXManager(txStore, WithMonitorTick(100*time.Millisecond), WithLogger(log.NewNopLogger()))
+	defer other.Stop()
+
+	c := &mockComponent{id: "component", ack: true}
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	handle, err := txManager.Submit(context.Background(), []*RequestEntity{{ComponentID: c.ID()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	result, err := other.Handle(handle.TXID()).Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != TXSuccessful {
+		t.Errorf("tx status: %s, want: %s", result.Status, TXSuccessful)
+	}
+	if len(result.Components) != 1 || result.Components[0].TryStatus != TrySucceesful {
+		t.Errorf("components: %+v", result.Components)
+	}
+}
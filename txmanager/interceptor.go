@@ -0,0 +1,38 @@
+package txmanager
+
+import (
+	"context"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+)
+
+// 组件调用拦截器
+// 1. 类似 gRPC 的 UnaryInterceptor, 包裹每一次 Try、Confirm、Cancel(以及 Saga 模式的 Action、Compensate)调用,
+//    可用于附加鉴权信息、打印日志、限流以及故障注入, 无需再手动包装每个 TCCComponent
+// 2. 第一阶段以及异步轮询流程中的组件调用都经过同一条拦截器链, 重试时每次调用都会重新经过拦截器链
+// 3. 按照 WithInterceptors 注入的顺序执行, 先注入的拦截器位于外层
+// 4. 拦截器可以不调用 handler 直接返回, 返回的结果与组件的响应结果同等对待
+
+// CallInfo 组件调用的信息
+type CallInfo struct {
+	TXID        string
+	ComponentID string
+	Phase       Phase
+	// 当前为第几次尝试, 从 1 开始
+	Attempt int
+}
+
+// Interceptor 组件调用拦截器, 通过调用 handler 执行拦截器链中的下一环
+// confirm、cancel 阶段的 req 只携带组件 id 以及事务 id
+type Interceptor func(ctx context.Context, req *component.TCCReq, info *CallInfo, handler Handler) (*component.TCCResp, error)
+
+// chainInterceptors 将拦截器链与实际的组件调用串联为一个 Handler
+func chainInterceptors(interceptors []Interceptor, info *CallInfo, handler Handler) Handler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+	return handler
+}
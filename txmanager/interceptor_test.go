@@ -0,0 +1,94 @@
+package txmanager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+func Test_InterceptorChain(t *testing.T) {
+	var mux sync.Mutex
+	var calls []string
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, req *component.TCCReq, info *CallInfo, handler Handler) (*component.TCCResp, error) {
+			mux.Lock()
+			calls = append(calls, fmt.Sprintf("%s:%s:%s:%s", name, info.Phase, info.ComponentID, info.TXID))
+			mux.Unlock()
+			return handler(ctx, req)
+		}
+	}
+	txManager := NewTXManager(NewMemTXStore(), WithMonitorTick(time.Hour), WithLogger(log.NewNopLogger()),
+		WithInterceptors(record("outer")), WithInterceptors(record("inner")))
+	defer txManager.Stop()
+
+	c := &mockComponent{id: "component", ack: true}
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	result, err := txManager.Execute(context.Background(), &RequestEntity{ComponentID: c.ID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一阶段以及异步推进的第二阶段都经过拦截器链
+	want := []string{
+		fmt.Sprintf("outer:try:%s:%s", c.ID(), result.TXID),
+		fmt.Sprintf("inner:try:%s:%s", c.ID(), result.TXID),
+		fmt.Sprintf("outer:confirm:%s:%s", c.ID(), result.TXID),
+		fmt.Sprintf("inner:confirm:%s:%s", c.ID(), result.TXID),
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mux.Lock()
+		got := append([]string{}, calls...)
+		mux.Unlock()
+		if len(got) >= len(want) {
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("calls: %v, want: %v", got, want)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("calls: %v, want: %v", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Test_InterceptorFaultInjection 拦截器可以不调用组件直接返回, 且重试时每次调用都会经过拦截器
+func Test_InterceptorFaultInjection(t *testing.T) {
+	var injected int32
+	inject := func(ctx context.Context, req *component.TCCReq, info *CallInfo, handler Handler) (*component.TCCResp, error) {
+		if info.Phase == PhaseTry && info.Attempt == 1 {
+			atomic.AddInt32(&injected, 1)
+			return nil, fmt.Errorf("injected fault, component: %s", info.ComponentID)
+		}
+		return handler(ctx, req)
+	}
+	txManager := NewTXManager(NewMemTXStore(), WithMonitorTick(time.Hour), WithLogger(log.NewNopLogger()), WithInterceptors(inject))
+	defer txManager.Stop()
+
+	c := &flakyComponent{mockComponent: mockComponent{id: "flaky", ack: true}}
+	if err := txManager.Register(c, WithMaxAttempts(2), WithBackoff(time.Millisecond, time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	success, err := txManager.Transaction(context.Background(), &RequestEntity{ComponentID: c.ID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !success {
+		t.Error("tx failed")
+	}
+	if got := atomic.LoadInt32(&injected); got != 1 {
+		t.Errorf("injected: %d, want: 1", got)
+	}
+	if tries := atomic.LoadInt32(&c.tries); tries != 1 {
+		t.Errorf("try called %d times, want: 1", tries)
+	}
+}
@@ -0,0 +1,90 @@
+package txmanager
+
+import (
+	"context"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+	"github.com/xiaoxuxiansheng/gotcc/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Phase 组件调用所处的阶段
+type Phase string
+
+func (p Phase) String() string {
+	return string(p)
+}
+
+const (
+	PhaseTry     Phase = "try"
+	PhaseConfirm Phase = "confirm"
+	PhaseCancel  Phase = "cancel"
+)
+
+// Handler 执行一次组件调用, confirm、cancel 阶段的请求只携带组件 id 以及事务 id
+type Handler func(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error)
+
+// invoke 按照组件的调用配置执行组件调用, 第一阶段以及异步轮询流程中对组件的调用都需要经过这里
+//  1. 每次调用都使用独立的超时 context, 超时时长由组件在所处阶段的配置决定
+//  2. 调用出错时按照退避策略重试, 直到达到最大尝试次数或者 ctx 终止
+//  3. 组件明确拒绝请求(ACK 为 false)时不会重试
+//  4. 组件 id、所处阶段以及尝试次数会附加在 ctx 中, 组件内通过 log 包打印的日志同样会携带这些字段
+//  5. 每次调用的耗时以及结果都会通过 Metrics 上报
+//  6. 整个调用过程(包含重试)对应一个子 span, 每次失败的调用都会记录在 span 中
+//  7. 每次调用都会经过 WithInterceptors 注入的拦截器链, 拦截器收到的是请求的拷贝, 修改请求不会影响后续的重试
+//  8. 组件或者拦截器返回 (nil, nil) 时视为调用出错(ErrNilResponse), 因此 err 为 nil 时 resp 必然不为 nil
+//  9. 请求的 Metadata 同时通过 component.WithMetadata 注入组件收到的 ctx, 只接收事务 id 的 Confirm、Cancel 同样能够获取 trace 上下文
+func (t *TXManager) invoke(ctx context.Context, phase Phase, req *component.TCCReq, handler Handler) (resp *component.TCCResp, err error) {
+	ctx, span := t.startComponentSpan(ctx, req.TXID, req.ComponentID, phase)
+	defer func() {
+		span.SetAttributes(attrACK.Bool(acked(resp, err)))
+		endSpan(span, err)
+	}()
+
+	opts := t.registryCenter.getOptions(req.ComponentID)
+	backoff := opts.Backoff
+	// 以拦截器链处理后的 Metadata 为准注入 ctx
+	terminal := func(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+		return handler(component.WithMetadata(ctx, req.Metadata), req)
+	}
+	for attempt := 1; ; attempt++ {
+		actx := log.WithFields(ctx, log.KeyComponentID, req.ComponentID, log.KeyPhase, phase.String(), log.KeyAttempt, attempt)
+		// trace 上下文通过 Metadata 传递给组件
+		areq := *req
+		areq.Metadata = t.metadata(ctx)
+		info := &CallInfo{TXID: req.TXID, ComponentID: req.ComponentID, Phase: phase, Attempt: attempt}
+		start := time.Now()
+		resp, err = invokeOnce(actx, opts.timeout(phase), &areq, chainInterceptors(t.opts.Interceptors, info, terminal))
+		t.opts.Metrics.ComponentCalled(req.ComponentID, phase, time.Since(start), acked(resp, err), err)
+		span.SetAttributes(attrAttempt.Int(attempt))
+		if err == nil || attempt >= opts.MaxAttempts {
+			return resp, err
+		}
+		span.RecordError(err, trace.WithAttributes(attrAttempt.Int(attempt)))
+		t.logger(actx).Warnw("component call failed, retrying", "err", err, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return resp, err
+		case <-time.After(backoff):
+		}
+		if backoff <<= 1; backoff > opts.MaxBackoff {
+			backoff = opts.MaxBackoff
+		}
+	}
+}
+
+// invokeOnce 执行单次组件调用, timeout 为 0 时不单独限制超时时长
+func invokeOnce(ctx context.Context, timeout time.Duration, req *component.TCCReq, handler Handler) (*component.TCCResp, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	resp, err := handler(ctx, req)
+	if err == nil && resp == nil {
+		return nil, ErrNilResponse
+	}
+	return resp, err
+}
@@ -0,0 +1,232 @@
+package txmanager
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+// flakyComponent 前 failures 次 try 请求报错的 TCC 组件
+type flakyComponent struct {
+	mockComponent
+	failures int32
+	tries    int32
+}
+
+func (f *flakyComponent) Try(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+	if atomic.AddInt32(&f.tries, 1) <= f.failures {
+		return nil, errors.New("try failed")
+	}
+	return f.mockComponent.Try(ctx, req)
+}
+
+// hangingComponent confirm 请求阻塞直到 ctx 终止的 TCC 组件, 通过 ComponentOptionsProvider 声明调用配置
+type hangingComponent struct {
+	mockComponent
+	opts ComponentOptions
+}
+
+func (h *hangingComponent) Confirm(ctx context.Context, txID string) (*component.TCCResp, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (h *hangingComponent) ComponentOptions() ComponentOptions {
+	return h.opts
+}
+
+func Test_InvokeRetry(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []ComponentOption
+		want  bool
+		tries int32
+	}{
+		{name: "no retry", want: false, tries: 1},
+		{name: "retry", opts: []ComponentOption{WithMaxAttempts(3), WithBackoff(time.Millisecond, 2*time.Millisecond)}, want: true, tries: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txManager := NewTXManager(NewMemTXStore(), WithMonitorTick(time.Hour))
+			defer txManager.Stop()
+
+			c := &flakyComponent{mockComponent: mockComponent{id: "flaky", ack: true}, failures: 2}
+			if err := txManager.Register(c, tt.opts...); err != nil {
+				t.Fatal(err)
+			}
+
+			success, err := txManager.Transaction(context.Background(), &RequestEntity{ComponentID: c.ID()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if success != tt.want {
+				t.Errorf("tx success: %t, want: %t", success, tt.want)
+			}
+			if tries := atomic.LoadInt32(&c.tries); tries != tt.tries {
+				t.Errorf("try called %d times, want: %d", tries, tt.tries)
+			}
+		})
+	}
+}
+
+func Test_InvokeTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ComponentOption
+		want time.Duration
+	}{
+		{name: "provider", want: 50 * time.Millisecond},
+		{name: "register override", opts: []ComponentOption{WithConfirmTimeout(100 * time.Millisecond)}, want: 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txStore := NewMemTXStore()
+			txManager := NewTXManager(txStore, WithTimeout(time.Hour), WithMonitorTick(time.Hour))
+			defer txManager.Stop()
+
+			c := &hangingComponent{
+				mockComponent: mockComponent{id: "hanging", ack: true},
+				opts:          ComponentOptions{ConfirmTimeout: 50 * time.Millisecond},
+			}
+			if err := txManager.Register(c, tt.opts...); err != nil {
+				t.Fatal(err)
+			}
+
+			// try 成功, 等待异步轮询流程推进 confirm
+			ctx := context.Background()
+			txID, err := txStore.CreateTX(ctx, NewTransaction(ComponentEntities{{Component: c}}, time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = txStore.TXUpdate(ctx, txID, c.ID(), true); err != nil {
+				t.Fatal(err)
+			}
+
+			// confirm 阻塞的组件不能无限期地阻塞异步轮询流程
+			start := time.Now()
+			if err = txManager.advanceProgressByTXID(txManager.ctx, txID); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("advance progress err: %v, want: %v", err, context.DeadlineExceeded)
+			}
+			if cost := time.Since(start); cost < tt.want || cost > tt.want+time.Second {
+				t.Errorf("advance progress cost: %v, want about: %v", cost, tt.want)
+			}
+		})
+	}
+}
+
+// fieldsComponent 记录 try 请求 ctx 中携带的日志字段
+type fieldsComponent struct {
+	mockComponent
+	fields []interface{}
+}
+
+func (f *fieldsComponent) Try(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+	f.fields = log.Fields(ctx)
+	return f.mockComponent.Try(ctx, req)
+}
+
+// Test_InvokeLogFields 组件收到的 ctx 中携带事务 id、组件 id、所处阶段以及尝试次数
+func Test_InvokeLogFields(t *testing.T) {
+	txManager := NewTXManager(NewMemTXStore(), WithMonitorTick(time.Hour), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+
+	c := &fieldsComponent{mockComponent: mockComponent{id: "fields", ack: true}}
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	result, err := txManager.Execute(context.Background(), &RequestEntity{ComponentID: c.ID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := make(map[interface{}]interface{})
+	for i := 0; i+1 < len(c.fields); i += 2 {
+		fields[c.fields[i]] = c.fields[i+1]
+	}
+	want := map[interface{}]interface{}{
+		log.KeyTXID:        result.TXID,
+		log.KeyComponentID: c.ID(),
+		log.KeyPhase:       PhaseTry.String(),
+		log.KeyAttempt:     1,
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("field: %v, got: %v, want: %v", key, fields[key], value)
+		}
+	}
+}
+
+// Test_InvokeNilResponse 组件或者拦截器返回 (nil, nil) 时按照调用出错处理, 而不是解引用空的响应
+func Test_InvokeNilResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		phase   Phase
+		saga    bool
+		ack     bool
+		recover bool
+		// 期望事务日志中的事务状态
+		status TXStatus
+	}{
+		{name: "try", phase: PhaseTry, ack: true, status: TXFailure},
+		{name: "confirm", phase: PhaseConfirm, ack: true, status: TXHanging},
+		{name: "retry try", phase: PhaseTry, ack: true, recover: true, status: TXHanging},
+		{name: "saga action", phase: PhaseTry, saga: true, ack: true, status: TXFailure},
+		{name: "saga retry action", phase: PhaseTry, saga: true, ack: true, recover: true, status: TXHanging},
+		{name: "saga compensate", phase: PhaseCancel, saga: true, status: TXHanging},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nilResp := func(ctx context.Context, req *component.TCCReq, info *CallInfo, handler Handler) (*component.TCCResp, error) {
+				if info.Phase == tt.phase {
+					return nil, nil
+				}
+				return handler(ctx, req)
+			}
+			txStore := NewMemTXStore()
+			txManager := NewTXManager(txStore, WithMonitorTick(time.Hour), WithSecondPhase(SecondPhaseSync),
+				WithInterceptors(nilResp), WithLogger(log.NewNopLogger()))
+			defer txManager.Stop()
+
+			entity := &ComponentEntity{Component: &mockComponent{id: "component", ack: tt.ack}}
+			if tt.saga {
+				entity = &ComponentEntity{Saga: &mockSagaComponent{id: "component", ack: tt.ack, recorder: &sagaRecorder{}}}
+				if err := txManager.RegisterSaga(entity.Saga); err != nil {
+					t.Fatal(err)
+				}
+			} else if err := txManager.Register(entity.Component); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			var txID string
+			if tt.recover {
+				// 创建事务的节点在 try 期间宕机, 由异步轮询流程补发 try
+				var err error
+				if txID, err = txStore.CreateTX(ctx, NewTransaction(ComponentEntities{entity}, time.Hour)); err != nil {
+					t.Fatal(err)
+				}
+				if err = txManager.advanceProgressByTXID(txManager.ctx, txID); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				result, err := txManager.Execute(ctx, &RequestEntity{ComponentID: "component"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !errors.Is(result.Err(), ErrNilResponse) && !errors.Is(result.FinalizeErr, ErrNilResponse) {
+					t.Errorf("err: %v, finalize err: %v, want: %v", result.Err(), result.FinalizeErr, ErrNilResponse)
+				}
+				txID = result.TXID
+			}
+
+			if tx, _ := txStore.GetTX(ctx, txID); tx.Status != tt.status {
+				t.Errorf("tx status: %s, want: %s", tx.Status, tt.status)
+			}
+		})
+	}
+}
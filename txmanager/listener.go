@@ -0,0 +1,131 @@
+package txmanager
+
+import (
+	"context"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+// 事务生命周期事件
+// 1. 使用方可以通过 WithListener 注册监听器, 在事务状态变化时进行告警、更新业务记录或者审计
+// 2. 事件在事务执行流程中产生, 投递到 TXManager 内部的缓冲队列后由独立的 goroutine 依次分发给各个监听器
+//  2.1 监听器的耗时不会阻塞事务流程, 队列已满时新产生的事件会被丢弃并打印告警日志
+//  2.2 监听器 panic 时会被 recover 并打印错误日志, 不会影响其他监听器以及事务流程
+// 3. 与第二阶段的异步推进一样, 同一事件可能被重复投递(例如异步轮询流程重复推进同一笔事务), 监听器需要自行保证幂等
+
+// EventType 事件类型
+type EventType string
+
+func (e EventType) String() string {
+	return string(e)
+}
+
+const (
+	// EventTXCreated 事务明细记录创建成功
+	EventTXCreated EventType = "tx_created"
+	// EventComponentTried 组件的 try(Saga 模式下为正向操作)执行结束, 包括异步轮询流程补发的 try
+	EventComponentTried EventType = "component_tried"
+	// EventTXDecided 第一阶段结束, 事务的成败已经确定, 可能由事务发起方或者异步轮询流程判定
+	EventTXDecided EventType = "tx_decided"
+	// EventComponentConfirmed 组件的 confirm 执行结束
+	EventComponentConfirmed EventType = "component_confirmed"
+	// EventComponentCancelled 组件的 cancel(Saga 模式下为补偿操作)执行结束
+	EventComponentCancelled EventType = "component_cancelled"
+	// EventTXFinalized 事务的最终状态通过 TXSubmit 提交成功, 或者事务通过 TXDeadLetter 被置为 dead_letter 状态(此时 Err 为最后一次失败的原因)
+	EventTXFinalized EventType = "tx_finalized"
+	// EventTXForced 运维人员通过 ForceConfirm、ForceCancel 强制决议事务的成败, 在强制决议持久化之后、执行第二阶段之前投递. 事件可能因队列已满而被丢弃, 审计以事务日志中持久化的 ForceReason 为准
+	EventTXForced EventType = "tx_forced"
+)
+
+// Event 事务生命周期事件, 未涉及的字段为零值
+type Event struct {
+	Type EventType
+	// 事件产生的时间
+	Time time.Time
+	TXID string
+	Mode TXMode
+	// 事务状态, EventTXDecided、EventTXFinalized、EventTXForced 事件有效
+	Status TXStatus
+	// 事务是否因超过截止时间而失败, EventTXDecided、EventTXFinalized 事件有效
+	Timeout bool
+	// 事务中的各个组件, EventTXCreated 事件有效
+	Components []*ComponentTryEntity
+	// 组件 id 以及所处阶段, 组件相关的事件有效
+	ComponentID string
+	Phase       Phase
+	// 组件的请求参数, EventComponentTried 事件有效
+	Request map[string]interface{}
+	// 组件是否接受了请求以及调用返回的错误, 组件拒绝请求时 ACK 为 false 且 Err 为 nil
+	ACK bool
+	Err error
+	// 运维人员强制决议的原因, EventTXForced 事件有效
+	Reason string
+}
+
+// Listener 事务生命周期事件的监听器
+type Listener interface {
+	OnEvent(event *Event)
+}
+
+// ListenerFunc 将函数适配为 Listener
+type ListenerFunc func(event *Event)
+
+func (f ListenerFunc) OnEvent(event *Event) {
+	f(event)
+}
+
+// emit 投递事件, 队列已满时丢弃事件, 不会阻塞事务流程
+func (t *TXManager) emit(ctx context.Context, event *Event) {
+	if len(t.opts.Listeners) == 0 {
+		return
+	}
+	event.Time = time.Now()
+	if event.Mode == "" {
+		event.Mode = TXModeTCC
+	}
+	select {
+	case t.events <- event:
+	default:
+		t.logger(ctx).Warnw("listener queue full, event dropped", "event", event.Type.String(), log.KeyComponentID, event.ComponentID)
+	}
+}
+
+// dispatch 将队列中的事件依次分发给各个监听器, TXManager 停止后分发完队列中剩余的事件再退出
+func (t *TXManager) dispatch() {
+	for {
+		select {
+		case event := <-t.events:
+			t.notify(event)
+		case <-t.ctx.Done():
+			for {
+				select {
+				case event := <-t.events:
+					t.notify(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// notify 将事件分发给各个监听器, 单个监听器 panic 不影响其他监听器
+func (t *TXManager) notify(event *Event) {
+	for _, listener := range t.opts.Listeners {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.logger(context.Background()).Errorw("listener panic", log.KeyTXID, event.TXID, "event", event.Type.String(), "panic", r)
+				}
+			}()
+			listener.OnEvent(event)
+		}()
+	}
+}
+
+// acked 组件调用是否成功且组件接受了请求
+func acked(resp *component.TCCResp, err error) bool {
+	return err == nil && resp != nil && resp.ACK
+}
@@ -0,0 +1,135 @@
+package txmanager
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+// recordListener 记录收到的事件
+type recordListener struct {
+	mux    sync.Mutex
+	events []*Event
+}
+
+func (r *recordListener) OnEvent(event *Event) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.events = append(r.events, event)
+}
+
+// wait 等待收到事务的 EventTXFinalized 事件, 并返回该事务的事件类型序列
+func (r *recordListener) wait(t *testing.T, txID string) []EventType {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r.mux.Lock()
+		var types []EventType
+		for _, event := range r.events {
+			if event.TXID == txID {
+				types = append(types, event.Type)
+			}
+		}
+		r.mux.Unlock()
+		if len(types) > 0 && types[len(types)-1] == EventTXFinalized {
+			return types
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("tx: %s not finalized, events: %v", txID, types)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_Listener(t *testing.T) {
+	listener := &recordListener{}
+	panicked := make(chan struct{}, 16)
+	panicListener := ListenerFunc(func(event *Event) {
+		panicked <- struct{}{}
+		panic("mock")
+	})
+	txManager := NewTXManager(NewMemTXStore(), WithMonitorTick(time.Hour), WithLogger(log.NewNopLogger()),
+		WithListener(panicListener), WithListener(listener))
+	defer txManager.Stop()
+
+	ok, rejected := &mockComponent{id: "ok", ack: true}, &mockComponent{id: "rejected"}
+	for _, c := range []*mockComponent{ok, rejected} {
+		if err := txManager.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		reqs []*RequestEntity
+		want []EventType
+	}{
+		{
+			name: "successful",
+			reqs: []*RequestEntity{{ComponentID: ok.ID()}},
+			want: []EventType{EventTXCreated, EventComponentTried, EventTXDecided, EventComponentConfirmed, EventTXFinalized},
+		},
+		{
+			name: "failure",
+			reqs: []*RequestEntity{{ComponentID: ok.ID()}, {ComponentID: rejected.ID(), DependsOn: []string{ok.ID()}}},
+			want: []EventType{EventTXCreated, EventComponentTried, EventComponentTried, EventTXDecided, EventComponentCancelled, EventComponentCancelled, EventTXFinalized},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := txManager.Execute(context.Background(), tt.reqs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := listener.wait(t, result.TXID)
+			if len(got) != len(tt.want) {
+				t.Fatalf("events: %v, want: %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("events: %v, want: %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	// 监听器 panic 不影响其他监听器
+	if len(panicked) == 0 {
+		t.Error("panic listener not called")
+	}
+}
+
+// Test_ListenerSlow 监听器阻塞时不影响事务流程, 队列已满的事件会被丢弃
+func Test_ListenerSlow(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	slow := ListenerFunc(func(event *Event) {
+		<-block
+	})
+	txManager := NewTXManager(NewMemTXStore(), WithMonitorTick(time.Hour), WithLogger(log.NewNopLogger()),
+		WithListener(slow), WithListenerBuffer(1))
+	defer txManager.Stop()
+
+	c := &mockComponent{id: "component", ack: true}
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			if _, err := txManager.Transaction(context.Background(), &RequestEntity{ComponentID: c.ID()}); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("transaction blocked by slow listener")
+	}
+}
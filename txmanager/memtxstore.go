@@ -0,0 +1,371 @@
+package txmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemTXStore 基于内存实现的事务日志存储模块
+// 1. 适用于单测以及单节点部署的场景, 进程退出后事务日志随之丢失
+// 2. 通过互斥锁保证并发安全, 读写事务时均进行拷贝, 避免调用方修改内部状态
+// 3. Lock 为进程内的锁, 到达过期时间后自动失效; fencing token 为进程内的自增计数器
+// 4. 未完成的事务单独维护有序索引, 分页获取 hanging 事务时从游标位置开始遍历, 耗时与已完成的事务数量无关
+type MemTXStore struct {
+	mux sync.Mutex
+	seq int64
+	txs map[string]*Transaction
+	// 状态为 hanging 的事务, 按照创建时间以及自增序列排列
+	hanging []memCursor
+	// 各事务已经接受过的最大 fencing token
+	fencingTokens map[string]int64
+	lockToken     int64
+	lockExpireAt  time.Time
+}
+
+// NewMemTXStore 构造基于内存实现的事务日志存储模块
+func NewMemTXStore() *MemTXStore {
+	return &MemTXStore{
+		txs:           make(map[string]*Transaction),
+		fencingTokens: make(map[string]int64),
+	}
+}
+
+// CreateTX 创建一条事务明细记录, 事务 id 为自增序列
+func (m *MemTXStore) CreateTX(ctx context.Context, tx *Transaction) (string, error) {
+	if tx == nil {
+		return "", errors.New("nil tx")
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.seq++
+	record := copyTransaction(tx)
+	record.TXID = strconv.FormatInt(m.seq, 10)
+	record.Status = TXHanging
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	for _, component := range record.Components {
+		component.TryStatus = TryHanging
+	}
+	m.txs[record.TXID] = record
+	m.addHanging(memCursorOf(record))
+	return record.TXID, nil
+}
+
+// TXUpdate 更新事务中指定组件的 try 请求响应结果
+func (m *MemTXStore) TXUpdate(ctx context.Context, txID string, componentID string, accept bool) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	tx, ok := m.txs[txID]
+	if !ok {
+		return fmt.Errorf("tx: %s not existed", txID)
+	}
+	if tx.Status != TXHanging {
+		return fmt.Errorf("tx: %s already finished, status: %s", txID, tx.Status)
+	}
+	token, err := CheckFencingToken(ctx, m.fencingTokens[txID])
+	if err != nil {
+		return err
+	}
+
+	for _, component := range tx.Components {
+		if component.ComponentID != componentID {
+			continue
+		}
+		if component.TryStatus != TryHanging {
+			return fmt.Errorf("%w, component: %s, try status: %s", ErrTryDecided, componentID, component.TryStatus)
+		}
+		component.TryStatus = TryFailure
+		if accept {
+			component.TryStatus = TrySucceesful
+		}
+		m.fencingTokens[txID] = token
+		return nil
+	}
+	return fmt.Errorf("component: %s not existed in tx: %s", componentID, txID)
+}
+
+// TXRenewOwner 续约创建事务的节点对事务第一阶段的所有权租约
+func (m *MemTXStore) TXRenewOwner(ctx context.Context, txID string, expireAt time.Time) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	tx, ok := m.txs[txID]
+	if !ok {
+		return fmt.Errorf("tx: %s not existed", txID)
+	}
+	if tx.Status != TXHanging {
+		return fmt.Errorf("tx: %s already finished, status: %s", txID, tx.Status)
+	}
+	tx.OwnerExpireAt = expireAt
+	return nil
+}
+
+// TXSubmit 提交事务的最终状态, 重复提交相同的状态视为成功, dead_letter 状态的事务允许人工介入后提交
+func (m *MemTXStore) TXSubmit(ctx context.Context, txID string, success bool) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	tx, ok := m.txs[txID]
+	if !ok {
+		return fmt.Errorf("tx: %s not existed", txID)
+	}
+
+	status := TXFailure
+	if success {
+		status = TXSuccessful
+	}
+	if tx.Status != TXHanging && tx.Status != TXDeadLetter && tx.Status != status {
+		return fmt.Errorf("tx: %s already finished, status: %s", txID, tx.Status)
+	}
+	token, err := CheckFencingToken(ctx, m.fencingTokens[txID])
+	if err != nil {
+		return err
+	}
+	if tx.Status == TXHanging {
+		m.removeHanging(tx)
+	}
+	tx.Status, m.fencingTokens[txID] = status, token
+	return nil
+}
+
+// TXRetry 记录推进事务第二阶段失败的结果
+func (m *MemTXStore) TXRetry(ctx context.Context, txID string, attempts int, nextRetryAt time.Time, lastErr string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	tx, ok := m.txs[txID]
+	if !ok {
+		return fmt.Errorf("tx: %s not existed", txID)
+	}
+	if tx.Status != TXHanging {
+		return fmt.Errorf("tx: %s already finished, status: %s", txID, tx.Status)
+	}
+	token, err := CheckFencingToken(ctx, m.fencingTokens[txID])
+	if err != nil {
+		return err
+	}
+	tx.Attempts, tx.NextRetryAt, tx.LastError = attempts, nextRetryAt, lastErr
+	m.fencingTokens[txID] = token
+	return nil
+}
+
+// TXDeadLetter 将事务置为 dead_letter 终态, 重复置为 dead_letter 视为成功
+func (m *MemTXStore) TXDeadLetter(ctx context.Context, txID string, lastErr string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	tx, ok := m.txs[txID]
+	if !ok {
+		return fmt.Errorf("tx: %s not existed", txID)
+	}
+	if tx.Status != TXHanging && tx.Status != TXDeadLetter {
+		return fmt.Errorf("tx: %s already finished, status: %s", txID, tx.Status)
+	}
+	token, err := CheckFencingToken(ctx, m.fencingTokens[txID])
+	if err != nil {
+		return err
+	}
+	if tx.Status == TXHanging {
+		m.removeHanging(tx)
+	}
+	tx.Status, tx.LastError = TXDeadLetter, lastErr
+	m.fencingTokens[txID] = token
+	return nil
+}
+
+// TXForce 持久化强制决议以及原因
+func (m *MemTXStore) TXForce(ctx context.Context, txID string, success bool, reason string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	tx, ok := m.txs[txID]
+	if !ok {
+		return fmt.Errorf("tx: %s not existed", txID)
+	}
+	if tx.Status != TXHanging && tx.Status != TXDeadLetter {
+		return fmt.Errorf("tx: %s already finished, status: %s", txID, tx.Status)
+	}
+
+	status := TXFailure
+	if success {
+		status = TXSuccessful
+	}
+	if tx.ForcedStatus != "" {
+		if tx.ForcedStatus != status {
+			return fmt.Errorf("tx: %s already forced, status: %s", txID, tx.ForcedStatus)
+		}
+		return nil
+	}
+	tx.ForcedStatus, tx.ForceReason = status, reason
+	return nil
+}
+
+// GetHangingTXs 分页获取满足查询条件的未完成的事务, 按照创建时间由早到晚排列
+// 游标为上一页最后一笔事务的创建时间以及自增序列, 创建时间相同的事务之间按照自增序列排列
+func (m *MemTXStore) GetHangingTXs(ctx context.Context, query HangingQuery) ([]*Transaction, string, error) {
+	after, err := parseMemCursor(query.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	// 1. 在有序索引中定位游标之后的第一笔事务
+	start := 0
+	if query.Cursor != "" {
+		start = sort.Search(len(m.hanging), func(i int) bool {
+			return after.before(m.hanging[i])
+		})
+	}
+
+	// 2. 多取一笔事务用于判断是否存在下一页
+	txs := make([]*Transaction, 0)
+	var next string
+	for _, cursor := range m.hanging[start:] {
+		tx := m.txs[strconv.FormatInt(cursor.seq, 10)]
+		if !query.Match(tx.TXID) {
+			continue
+		}
+		if query.Limit > 0 && len(txs) == query.Limit {
+			next = memCursorOf(txs[len(txs)-1]).String()
+			break
+		}
+		txs = append(txs, copyTransaction(tx))
+	}
+	return txs, next, nil
+}
+
+// addHanging 将事务插入 hanging 事务的有序索引
+func (m *MemTXStore) addHanging(cursor memCursor) {
+	i := sort.Search(len(m.hanging), func(i int) bool {
+		return cursor.before(m.hanging[i])
+	})
+	m.hanging = append(m.hanging, memCursor{})
+	copy(m.hanging[i+1:], m.hanging[i:])
+	m.hanging[i] = cursor
+}
+
+// removeHanging 将事务从 hanging 事务的有序索引中移除
+func (m *MemTXStore) removeHanging(tx *Transaction) {
+	cursor := memCursorOf(tx)
+	i := sort.Search(len(m.hanging), func(i int) bool {
+		return !m.hanging[i].before(cursor)
+	})
+	if i < len(m.hanging) && m.hanging[i] == cursor {
+		m.hanging = append(m.hanging[:i], m.hanging[i+1:]...)
+	}
+}
+
+// memCursor MemTXStore 的分页游标
+type memCursor struct {
+	createdAt int64
+	seq       int64
+}
+
+// memCursorOf 返回事务在 hanging 事务有序索引中的位置, 事务 id 即为自增序列
+func memCursorOf(tx *Transaction) memCursor {
+	seq, _ := strconv.ParseInt(tx.TXID, 10, 64)
+	return memCursor{createdAt: tx.CreatedAt.UnixNano(), seq: seq}
+}
+
+func parseMemCursor(s string) (memCursor, error) {
+	if s == "" {
+		return memCursor{}, nil
+	}
+	var cursor memCursor
+	if _, err := fmt.Sscanf(s, "%d-%d", &cursor.createdAt, &cursor.seq); err != nil {
+		return memCursor{}, fmt.Errorf("invalid cursor: %s, err: %w", s, err)
+	}
+	return cursor, nil
+}
+
+func (c memCursor) before(other memCursor) bool {
+	if c.createdAt != other.createdAt {
+		return c.createdAt < other.createdAt
+	}
+	return c.seq < other.seq
+}
+
+func (c memCursor) String() string {
+	return fmt.Sprintf("%d-%d", c.createdAt, c.seq)
+}
+
+// GetTX 获取指定的一笔事务
+func (m *MemTXStore) GetTX(ctx context.Context, txID string) (*Transaction, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	tx, ok := m.txs[txID]
+	if !ok {
+		return nil, fmt.Errorf("tx: %s not existed", txID)
+	}
+	return copyTransaction(tx), nil
+}
+
+// Lock 锁住整个 TXStore 模块, 锁在 expireDuration 之后自动失效, 返回自增的 fencing token
+func (m *MemTXStore) Lock(ctx context.Context, expireDuration time.Duration) (int64, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	now := time.Now()
+	if now.Before(m.lockExpireAt) {
+		return 0, errors.New("tx store locked")
+	}
+	m.lockToken++
+	m.lockExpireAt = now.Add(expireDuration)
+	return m.lockToken, nil
+}
+
+// RenewLock 锁仍由 token 持有且尚未过期时, 将锁的过期时间重置为 expireDuration 之后
+func (m *MemTXStore) RenewLock(ctx context.Context, token int64, expireDuration time.Duration) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	now := time.Now()
+	if m.lockToken != token || !now.Before(m.lockExpireAt) {
+		return fmt.Errorf("lock not held by token: %d", token)
+	}
+	m.lockExpireAt = now.Add(expireDuration)
+	return nil
+}
+
+// Unlock 解锁TXStore 模块, 锁已经被其他 token 持有时不做任何处理
+func (m *MemTXStore) Unlock(ctx context.Context, token int64) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.lockToken == token {
+		m.lockExpireAt = time.Time{}
+	}
+	return nil
+}
+
+// copyTransaction 拷贝事务, 组件的请求参数仅拷贝第一层
+func copyTransaction(tx *Transaction) *Transaction {
+	cp := *tx
+	cp.Components = make([]*ComponentTryEntity, 0, len(tx.Components))
+	for _, component := range tx.Components {
+		componentCopy := *component
+		if component.Request != nil {
+			componentCopy.Request = make(map[string]interface{}, len(component.Request))
+			for k, v := range component.Request {
+				componentCopy.Request[k] = v
+			}
+		}
+		if component.DependsOn != nil {
+			componentCopy.DependsOn = append([]string(nil), component.DependsOn...)
+		}
+		cp.Components = append(cp.Components, &componentCopy)
+	}
+	return &cp
+}
@@ -0,0 +1,14 @@
+package txmanager_test
+
+import (
+	"testing"
+
+	"github.com/xiaoxuxiansheng/gotcc/txmanager"
+	"github.com/xiaoxuxiansheng/gotcc/txmanager/txstoretest"
+)
+
+func Test_MemTXStore(t *testing.T) {
+	txstoretest.RunTXStoreSuite(t, func() txmanager.TXStore {
+		return txmanager.NewMemTXStore()
+	})
+}
@@ -0,0 +1,58 @@
+package txmanager
+
+import (
+	"context"
+	"time"
+)
+
+// Metrics TX Manager 的指标上报接口
+// 1. 使用方可以基于该接口对接 Prometheus 等监控系统, 例如将事务结果上报为 counter, 将组件调用耗时上报为 histogram
+// 2. 所有方法都在事务的执行流程中同步调用, 实现需要保证并发安全且不能阻塞
+type Metrics interface {
+	// TXStarted 创建了一笔事务
+	TXStarted(mode TXMode)
+	// TXFinished 事务的最终状态提交成功, timeout 为 true 表示事务因超过截止时间而失败. 事务被置为 dead_letter 状态时 status 为 TXDeadLetter
+	TXFinished(mode TXMode, status TXStatus, timeout bool)
+	// ComponentCalled 一次组件调用结束, 重试的每次调用都会单独上报
+	// err 为调用返回的错误, 组件拒绝请求时 err 为 nil 且 ack 为 false
+	ComponentCalled(componentID string, phase Phase, latency time.Duration, ack bool, err error)
+	// RecoveryTick 异步轮询流程开始一轮推进, 非 leader 节点每轮竞选 leader 同样视为一轮
+	// 分片恢复模式下每个分片的推进以及每轮分片的调整分别视为一轮
+	RecoveryTick()
+	// RecoveryLockFailed 异步轮询流程竞选 leader 失败, 分片恢复模式下为竞争分片的租约失败
+	RecoveryLockFailed()
+	// HangingTXs 一轮推进中分页获取到的 hanging 状态事务的总数
+	HangingTXs(count int)
+}
+
+// nopMetrics 不上报任何指标, 是 TXManager 默认使用的指标上报实现
+type nopMetrics struct{}
+
+func (nopMetrics) TXStarted(mode TXMode)                                 {}
+func (nopMetrics) TXFinished(mode TXMode, status TXStatus, timeout bool) {}
+func (nopMetrics) ComponentCalled(componentID string, phase Phase, latency time.Duration, ack bool, err error) {
+}
+func (nopMetrics) RecoveryTick()        {}
+func (nopMetrics) RecoveryLockFailed()  {}
+func (nopMetrics) HangingTXs(count int) {}
+
+// submit 提交事务的最终状态, 提交成功后上报事务结果、投递 EventTXFinalized 事件并唤醒等待该事务的句柄
+func (t *TXManager) submit(ctx context.Context, tx *Transaction, success bool) error {
+	if err := t.txStore.TXSubmit(ctx, tx.TXID, success); err != nil {
+		return err
+	}
+
+	status := TXFailure
+	if success {
+		status = TXSuccessful
+	}
+	mode := tx.Mode
+	if mode == "" {
+		mode = TXModeTCC
+	}
+	timeout := !success && tx.timedOut(time.Now())
+	t.opts.Metrics.TXFinished(mode, status, timeout)
+	t.emit(ctx, &Event{Type: EventTXFinalized, TXID: tx.TXID, Mode: mode, Status: status, Timeout: timeout})
+	t.waiters.notify(tx.TXID)
+	return nil
+}
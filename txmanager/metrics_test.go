@@ -0,0 +1,142 @@
+package txmanager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+// recordMetrics 记录上报指标的测试实现
+type recordMetrics struct {
+	mux      sync.Mutex
+	counters map[string]int
+}
+
+func newRecordMetrics() *recordMetrics {
+	return &recordMetrics{counters: make(map[string]int)}
+}
+
+func (r *recordMetrics) add(name string, delta int) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.counters[name] += delta
+}
+
+func (r *recordMetrics) get(name string) int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.counters[name]
+}
+
+func (r *recordMetrics) TXStarted(mode TXMode) {
+	r.add(fmt.Sprintf("tx_started_%s", mode), 1)
+}
+
+func (r *recordMetrics) TXFinished(mode TXMode, status TXStatus, timeout bool) {
+	r.add(fmt.Sprintf("tx_finished_%s_%s_%t", mode, status, timeout), 1)
+}
+
+func (r *recordMetrics) ComponentCalled(componentID string, phase Phase, latency time.Duration, ack bool, err error) {
+	r.add(fmt.Sprintf("component_called_%s_%s", componentID, phase), 1)
+	if err != nil {
+		r.add(fmt.Sprintf("component_error_%s_%s", componentID, phase), 1)
+	}
+}
+
+func (r *recordMetrics) RecoveryTick() {
+	r.add("recovery_tick", 1)
+}
+
+func (r *recordMetrics) RecoveryLockFailed() {
+	r.add("recovery_lock_failed", 1)
+}
+
+func (r *recordMetrics) HangingTXs(count int) {
+	r.add("hanging_txs", count)
+}
+
+// waitCounter 等待异步流程上报的指标达到预期值
+func waitCounter(t *testing.T, metrics *recordMetrics, name string, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for metrics.get(name) < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("metric: %s, got: %d, want: %d", name, metrics.get(name), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_MetricsTX(t *testing.T) {
+	metrics := newRecordMetrics()
+	txStore := NewMemTXStore()
+	txManager := NewTXManager(txStore, WithMonitorTick(time.Hour), WithMetrics(metrics), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+
+	ok, failed := &mockComponent{id: "ok", ack: true}, &mockComponent{id: "failed"}
+	for _, c := range []*mockComponent{ok, failed} {
+		if err := txManager.Register(c, WithMaxAttempts(2), WithBackoff(time.Millisecond, time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	if _, err := txManager.Execute(ctx, &RequestEntity{ComponentID: ok.ID()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := txManager.Execute(ctx, &RequestEntity{ComponentID: ok.ID()}, &RequestEntity{ComponentID: failed.ID()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟 try 尚未执行便已超时的事务
+	txID, err := txStore.CreateTX(ctx, NewTransaction(ComponentEntities{{Component: ok}}, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err = txManager.advanceProgressByTXID(txManager.ctx, txID); err != nil {
+		t.Fatal(err)
+	}
+
+	waitCounter(t, metrics, "tx_finished_tcc_successful_false", 1)
+	waitCounter(t, metrics, "tx_finished_tcc_failure_false", 1)
+	waitCounter(t, metrics, "tx_finished_tcc_failure_true", 1)
+	for name, want := range map[string]int{
+		"tx_started_tcc":                 2,
+		"component_called_ok_try":        2,
+		"component_called_failed_try":    2,
+		"component_error_failed_try":     2,
+		"component_called_ok_confirm":    1,
+		"component_called_failed_cancel": 1,
+	} {
+		if got := metrics.get(name); got != want {
+			t.Errorf("metric: %s, got: %d, want: %d", name, got, want)
+		}
+	}
+}
+
+func Test_MetricsRecovery(t *testing.T) {
+	metrics := newRecordMetrics()
+	txStore := NewMemTXStore()
+	ctx := context.Background()
+	if _, err := txStore.CreateTX(ctx, NewTransaction(ComponentEntities{{Component: &mockComponent{id: "component"}}}, time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	// 其他节点持有分布式锁
+	if _, err := txStore.Lock(ctx, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	txManager := NewTXManager(txStore, WithMonitorTick(20*time.Millisecond), WithMetrics(metrics), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+
+	waitCounter(t, metrics, "recovery_lock_failed", 1)
+	waitCounter(t, metrics, "hanging_txs", 1)
+	if metrics.get("recovery_tick") <= metrics.get("recovery_lock_failed") {
+		t.Errorf("recovery tick: %d, lock failed: %d", metrics.get("recovery_tick"), metrics.get("recovery_lock_failed"))
+	}
+}
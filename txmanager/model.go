@@ -1,6 +1,8 @@
 package txmanager
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/xiaoxuxiansheng/gotcc/component"
@@ -11,6 +13,8 @@ type RequestEntity struct {
 	ComponentID string `json:"componentName"`
 	// 组件入参 -> Try 请求时传递的参数
 	Request map[string]interface{} `json:"request"`
+	// 依赖的组件 ID -> 被依赖组件的 Try 成功后才会执行当前组件的 Try, Confirm 遵循相同的顺序, Cancel 则按照逆序执行
+	DependsOn []string `json:"dependsOn"`
 }
 
 type ComponentEntities []*ComponentEntity
@@ -25,9 +29,49 @@ func (c ComponentEntities) ToComponents() []component.TCCComponent {
 
 type ComponentEntity struct {
 	Request   map[string]interface{}
+	DependsOn []string
 	Component component.TCCComponent
+	// Saga 模式下的组件, 与 Component 二者有且仅有一个非空
+	Saga component.SagaComponent
 }
 
+// ID 返回组件唯一 id
+func (c *ComponentEntity) ID() string {
+	if c.Saga != nil {
+		return c.Saga.ID()
+	}
+	return c.Component.ID()
+}
+
+// TXMode 事务执行模式
+type TXMode string
+
+const (
+	// TCC 模式: Try-Confirm/Cancel 两阶段提交
+	TXModeTCC TXMode = "tcc"
+	// Saga 模式: 顺序执行正向操作, 失败时逆序执行补偿操作
+	TXModeSaga TXMode = "saga"
+)
+
+func (t TXMode) String() string {
+	return string(t)
+}
+
+var (
+	// ErrTryRejected 组件拒绝了 Try 请求
+	ErrTryRejected = errors.New("try rejected")
+	// ErrDependencyRejected 被依赖的组件 Try 失败, 当前组件的 Try 未被执行
+	ErrDependencyRejected = errors.New("dependency try rejected")
+	// ErrNotFinalized 同步执行第二阶段时, 第二阶段未能在截止时间之前完成, 事务的成败已经确定, 第二阶段由异步轮询流程兜底
+	ErrNotFinalized = errors.New("second phase not finalized")
+	// ErrNilResponse 组件(或者拦截器)未返回错误, 但是响应为空, 调用结果未知, 按照调用出错处理
+	ErrNilResponse = errors.New("nil component response")
+	// ErrTryDecided 组件的 try 结果已经写入事务日志, 不允许被再次覆盖
+	ErrTryDecided = errors.New("try already decided")
+	// ErrUndecided 第一阶段结束时事务的成败无法确定(例如失败的决议无法写入事务日志), 事务的成败由异步轮询流程决议
+	ErrUndecided = errors.New("tx undecided")
+)
+
 // 事务状态
 type TXStatus string
 
@@ -38,6 +82,8 @@ const (
 	TXSuccessful TXStatus = "successful"
 	// 事务失败
 	TXFailure TXStatus = "failure"
+	// 异步轮询流程推进事务的失败次数达到上限, 需要人工介入. 与 successful、failure 一样为终态, 异步轮询流程不再推进
+	TXDeadLetter TXStatus = "dead_letter"
 )
 
 func (t TXStatus) String() string {
@@ -61,39 +107,121 @@ const (
 type ComponentTryEntity struct {
 	ComponentID string
 	TryStatus   ComponentTryStatus
+	// 组件入参 -> Try 请求时传递的参数, 随事务日志一同持久化, 供异步轮询流程重新发起 Try 请求
+	Request map[string]interface{}
+	// 依赖的组件 ID, 随事务日志一同持久化, 供异步轮询流程按序推进第二阶段
+	DependsOn []string
 }
 
 // 事务
+// Saga 模式下复用 ComponentTryEntity 记录各组件正向操作的执行结果
 type Transaction struct {
 	TXID       string `json:"txID"`
 	Components []*ComponentTryEntity
-	Status     TXStatus  `json:"status"`
-	CreatedAt  time.Time `json:"createdAt"`
+	Status     TXStatus `json:"status"`
+	// 事务执行模式, 为空时视为 TCC 模式
+	Mode      TXMode    `json:"mode"`
+	CreatedAt time.Time `json:"createdAt"`
+	// 事务的截止时间, 由创建事务时的执行时长限制决定并随事务日志持久化
+	// 截止时间过后仍未成功的事务会被置为失败, 不受异步轮询节点当前 Timeout 配置的影响
+	Deadline time.Time `json:"deadline"`
+	// 创建事务的节点对事务第一阶段的所有权租约的到期时间, 第一阶段执行期间由创建事务的节点通过 TXStore.TXRenewOwner 续约
+	// 租约到期之前异步轮询流程不会补发 Try. 早期版本创建的事务为零值, 视为已经被创建事务的节点放弃
+	OwnerExpireAt time.Time `json:"ownerExpireAt"`
+	// 事务第一阶段根 span 的 W3C traceparent, 随事务日志持久化, 供异步轮询流程链接回原始链路. 未开启链路追踪时为空
+	TraceParent string `json:"traceParent"`
+	// 推进事务第二阶段失败的累计次数, 通过 TXStore.TXRetry 持久化
+	Attempts int `json:"attempts"`
+	// 下一次重试的时间, 在此之前异步轮询流程不会推进该事务
+	NextRetryAt time.Time `json:"nextRetryAt"`
+	// 最近一次推进失败的原因
+	LastError string `json:"lastError"`
+	// 运维人员强制决议的事务状态 successful/failure, 通过 TXStore.TXForce 持久化, 为空表示未被强制决议
+	// 推进被强制决议的事务时, 不再依据组件的 try 状态以及截止时间判定事务的成败
+	ForcedStatus TXStatus `json:"forcedStatus"`
+	// 强制决议的原因, 作为审计记录与强制决议一并持久化
+	ForceReason string `json:"forceReason"`
 }
 
-func NewTransaction(txID string, componentEntities ComponentEntities) *Transaction {
+// NewTransaction 构造一笔待创建的事务, 事务 id 由 TXStore.CreateTX 生成
+// timeout 为事务执行时长限制, 事务的截止时间为创建时间 + timeout
+func NewTransaction(componentEntities ComponentEntities, timeout time.Duration) *Transaction {
+	mode := TXModeTCC
 	entities := make([]*ComponentTryEntity, 0, len(componentEntities))
 	for _, componentEntity := range componentEntities {
+		if componentEntity.Saga != nil {
+			mode = TXModeSaga
+		}
 		entities = append(entities, &ComponentTryEntity{
-			ComponentID: componentEntity.Component.ID(),
+			ComponentID: componentEntity.ID(),
+			TryStatus:   TryHanging,
+			Request:     componentEntity.Request,
+			DependsOn:   componentEntity.DependsOn,
 		})
 	}
+	createdAt := time.Now()
 	return &Transaction{
-		TXID:       txID,
 		Components: entities,
+		Status:     TXHanging,
+		Mode:       mode,
+		CreatedAt:  createdAt,
+		Deadline:   createdAt.Add(timeout),
 	}
 }
 
-// getStatus 获取事务的状态
-func (t *Transaction) getStatus(createdBefore time.Time) TXStatus {
-	// 1 判断当前事务是否超时, 如果事务超时了，都还未被置为成功，直接置为失败
-	// t.CreatedAt.Before(createdBefore)
-	// 要是 t.CreatedAt 比 createdBefore小的话返回true 否则返回false
-	if t.CreatedAt.Before(createdBefore) {
-		return TXFailure
+// triesSucceeded 判断事务中所有组件的 try(Saga 模式下为正向操作)是否均已成功
+func (t *Transaction) triesSucceeded() bool {
+	for _, component := range t.Components {
+		if component.TryStatus != TrySucceesful {
+			return false
+		}
+	}
+	return true
+}
+
+// isSaga 判断事务是否为 Saga 模式
+func (t *Transaction) isSaga() bool {
+	return t.Mode == TXModeSaga
+}
+
+// repairDeadline 未持久化截止时间的事务(早期版本创建的事务)以创建时间 + defaultTimeout 作为截止时间
+func (t *Transaction) repairDeadline(defaultTimeout time.Duration) {
+	if t.Deadline.IsZero() {
+		t.Deadline = t.CreatedAt.Add(defaultTimeout)
 	}
+}
+
+// abandoned 判断创建事务的节点是否已经放弃事务的第一阶段: 所有权租约已经到期, 此时补发的 Try 不会与原始的第一阶段并发
+func (t *Transaction) abandoned(now time.Time) bool {
+	return t.OwnerExpireAt.Before(now)
+}
+
+// hasHangingComponents 判断事务中是否存在 try 结果未知的组件
+func (t *Transaction) hasHangingComponents() bool {
+	for _, component := range t.Components {
+		if component.TryStatus == TryHanging {
+			return true
+		}
+	}
+	return false
+}
 
-	// 2. 遍历判断当前事务的所有 TCC 组件是否有失败的, 一旦存在一个就把状态置为失败
+// timedOut 判断事务是否因超过截止时间而失败: 截止时间已过, 没有组件明确拒绝 try 请求, 且仍有组件的 try 结果未知
+func (t *Transaction) timedOut(now time.Time) bool {
+	if !t.Deadline.Before(now) {
+		return false
+	}
+	for _, component := range t.Components {
+		if component.TryStatus == TryFailure {
+			return false
+		}
+	}
+	return t.hasHangingComponents()
+}
+
+// getStatus 获取事务的状态
+func (t *Transaction) getStatus(now time.Time) TXStatus {
+	// 1. 遍历判断当前事务的所有 TCC 组件是否有失败的, 一旦存在一个就把状态置为失败
 	var hangingExist bool
 	for _, component := range t.Components {
 		if component.TryStatus == TryFailure {
@@ -103,9 +231,70 @@ func (t *Transaction) getStatus(createdBefore time.Time) TXStatus {
 		hangingExist = hangingExist || (component.TryStatus != TrySucceesful)
 	}
 
-	// 如果存在组件 try 操作没执行成功，则返回 hanging 状态
-	if hangingExist {
-		return TXHanging
+	// 2. 所有组件 try 均已成功时事务已经决议为成功, 不再受截止时间影响, 此时部分组件可能已经 confirm, 不能再 cancel
+	if !hangingExist {
+		return TXSuccessful
+	}
+
+	// 3. 仍有组件 try 结果未知时判断当前事务是否超时, 如果事务超过了截止时间, 直接置为失败
+	if t.Deadline.Before(now) {
+		return TXFailure
+	}
+	// 否则返回 hanging 状态
+	return TXHanging
+}
+
+// ComponentResult 单个组件在第一阶段(Try 或 Saga 正向操作)的执行结果
+type ComponentResult struct {
+	ComponentID string
+	// 组件 Try 的执行结果, 为 hanging 表示该组件的 Try 未被执行或未得到响应
+	TryStatus ComponentTryStatus
+	// 组件 Try 失败的原因, 组件拒绝 Try 请求时为 ErrTryRejected
+	Err error
+}
+
+// TXResult 事务执行结果
+type TXResult struct {
+	// 全局唯一的事务 id, 可用于后续查询事务
+	TXID string
+	// 第一阶段结束后确定的事务状态 successful/failure, 第二阶段由 TX Manager 异步推进
+	// 事务失败但是失败的决议未能写入事务日志时为 hanging, 事务的成败由异步轮询流程决议, Transaction 此时返回 ErrUndecided
+	Status TXStatus
+	// 各组件第一阶段的执行结果, 与事务中组件的执行顺序一致
+	Components []*ComponentResult
+	// 第二阶段是否已经执行完成且事务的最终状态已经提交, 仅同步执行第二阶段时可能为 true
+	Finalized bool
+	// 同步执行第二阶段失败(包括超过截止时间)的原因, 此时第二阶段由异步轮询流程兜底
+	FinalizeErr error
+}
+
+// newTXResult 构造事务执行结果, 各组件的执行结果初始化为 hanging
+func newTXResult(txID string, componentEntities ComponentEntities) *TXResult {
+	components := make([]*ComponentResult, 0, len(componentEntities))
+	for _, componentEntity := range componentEntities {
+		components = append(components, &ComponentResult{
+			ComponentID: componentEntity.ID(),
+			TryStatus:   TryHanging,
+		})
+	}
+	return &TXResult{
+		TXID:       txID,
+		Status:     TXHanging,
+		Components: components,
+	}
+}
+
+// Successful 事务是否执行成功
+func (t *TXResult) Successful() bool {
+	return t.Status == TXSuccessful
+}
+
+// Err 返回首个导致事务失败的组件错误
+func (t *TXResult) Err() error {
+	for _, component := range t.Components {
+		if component.Err != nil {
+			return fmt.Errorf("component: %s try failed, err: %w", component.ComponentID, component.Err)
+		}
 	}
-	return TXSuccessful
+	return nil
 }
@@ -0,0 +1,109 @@
+package txmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+// 运维接口
+// 1. 用于人工介入 dead_letter 状态或者长时间处于 hanging 状态的事务, 无需直接修改事务日志
+//  1.1 Inspect 查询事务的状态、各组件的 try 状态、失败次数、最近一次失败的原因以及强制决议
+//  1.2 Retry 立即重新执行事务的第二阶段, 不受事务自身重试时间的限制
+//  1.3 ForceConfirm、ForceCancel 忽略组件的 try 状态以及截止时间, 强制以 confirm 或者 cancel 推进第二阶段
+// 2. 以上操作与 advanceProgressByTXID 共用推进流程, 执行失败时同样累计失败次数; dead_letter 状态的事务推进成功后提交最终状态
+// 3. 强制决议以及原因在推进之前通过 TXStore.TXForce 持久化, 作为审计记录并约束后续的推进流程:
+//  3.1 推进中断后, 异步轮询流程以及 Retry 仍然遵循持久化的强制决议, 不会出现部分组件 confirm、部分组件 cancel 的情况
+//  3.2 已经被强制决议的事务不能再被强制决议为不同的结果
+// 4. 默认只有所有组件的 try 均已成功时才能强制 confirm, 否则需要通过 WithForceOverride 显式确认
+// 5. 运维接口的调用不持有 leader 租约, 可能与异步轮询流程并发推进同一笔事务, 这依赖于组件第二阶段操作的幂等性保证
+
+var (
+	// ErrTXFinished 事务已经处于 successful 或者 failure 终态, 不能再被人工介入
+	ErrTXFinished = errors.New("tx already finished")
+	// ErrReasonRequired 强制决议时没有提供原因
+	ErrReasonRequired = errors.New("force reason required")
+	// ErrTryNotSucceeded 事务中存在 try 未成功的组件, 强制 confirm 需要通过 WithForceOverride 显式确认
+	ErrTryNotSucceeded = errors.New("not every try succeeded")
+	// ErrForceConflict 事务已经被强制决议为不同的结果
+	ErrForceConflict = errors.New("tx already forced to another decision")
+)
+
+// Inspect 根据事务 id 查询事务日志中记录的事务
+func (t *TXManager) Inspect(ctx context.Context, txID string) (*Transaction, error) {
+	return t.txStore.GetTX(ctx, txID)
+}
+
+// Retry 立即重新执行事务的第二阶段, 返回执行后的事务
+// 事务中仍有 try 结果未知的组件且尚未超过截止时间时, 第二阶段无法执行, 返回的事务仍处于 hanging 状态
+func (t *TXManager) Retry(ctx context.Context, txID string) (*Transaction, error) {
+	if _, err := t.operableTX(ctx, txID); err != nil {
+		return nil, err
+	}
+	if err := t.advanceProgressByTXID(ctx, txID); err != nil {
+		return nil, err
+	}
+	return t.txStore.GetTX(ctx, txID)
+}
+
+// ForceConfirm 强制以 confirm 推进事务的第二阶段并将事务置为 successful, reason 为强制决议的原因
+// 事务中存在 try 未成功的组件时返回 ErrTryNotSucceeded, 除非通过 WithForceOverride 显式确认
+// Saga 模式的事务不执行补偿操作, 直接置为 successful
+func (t *TXManager) ForceConfirm(ctx context.Context, txID, reason string, opts ...ForceOption) (*Transaction, error) {
+	return t.force(ctx, txID, TXSuccessful, reason, opts...)
+}
+
+// ForceCancel 强制以 cancel 推进事务的第二阶段并将事务置为 failure, reason 为强制决议的原因
+// Saga 模式的事务对所有正向操作已经执行过的组件逆序执行补偿操作
+func (t *TXManager) ForceCancel(ctx context.Context, txID, reason string, opts ...ForceOption) (*Transaction, error) {
+	return t.force(ctx, txID, TXFailure, reason, opts...)
+}
+
+// force 持久化强制决议以及原因后, 以强制决议的结果推进事务
+func (t *TXManager) force(ctx context.Context, txID string, decision TXStatus, reason string, opts ...ForceOption) (*Transaction, error) {
+	forceOpts := ForceOptions{}
+	for _, opt := range opts {
+		opt(&forceOpts)
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, ErrReasonRequired
+	}
+	tx, err := t.operableTX(ctx, txID)
+	if err != nil {
+		return nil, err
+	}
+	if tx.ForcedStatus != "" && tx.ForcedStatus != decision {
+		return nil, fmt.Errorf("%w, tx: %s, forced: %s", ErrForceConflict, txID, tx.ForcedStatus)
+	}
+	if decision == TXSuccessful && !forceOpts.Override && !tx.triesSucceeded() {
+		return nil, fmt.Errorf("%w, tx: %s", ErrTryNotSucceeded, txID)
+	}
+
+	// 1. 先持久化强制决议, 推进中断后由异步轮询流程或者 Retry 遵循同一决议继续推进
+	if err = t.txStore.TXForce(ctx, txID, decision == TXSuccessful, reason); err != nil {
+		return nil, err
+	}
+	t.logger(ctx).Warnw("force tx decision", log.KeyTXID, txID, "status", tx.Status, "decision", decision, "reason", reason, "override", forceOpts.Override)
+	t.emit(ctx, &Event{Type: EventTXForced, TXID: txID, Mode: tx.Mode, Status: decision, Reason: reason})
+
+	// 2. 以强制决议的结果推进事务
+	if err = t.advanceProgressByTXID(ctx, txID); err != nil {
+		return nil, err
+	}
+	return t.txStore.GetTX(ctx, txID)
+}
+
+// operableTX 获取可以人工介入的事务, 只有 hanging 以及 dead_letter 状态的事务可以人工介入
+func (t *TXManager) operableTX(ctx context.Context, txID string) (*Transaction, error) {
+	tx, err := t.txStore.GetTX(ctx, txID)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Status != TXHanging && tx.Status != TXDeadLetter {
+		return nil, fmt.Errorf("%w, tx: %s, status: %s", ErrTXFinished, txID, tx.Status)
+	}
+	return tx, nil
+}
@@ -0,0 +1,210 @@
+package txmanager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+// operatorComponent 记录第二阶段的调用, confirm 是否接受请求可以在运行时切换
+type operatorComponent struct {
+	mockComponent
+	mux    sync.Mutex
+	accept bool
+	phases []Phase
+}
+
+func (o *operatorComponent) Confirm(ctx context.Context, txID string) (*component.TCCResp, error) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	o.phases = append(o.phases, PhaseConfirm)
+	return &component.TCCResp{ComponentID: o.id, TXID: txID, ACK: o.accept}, nil
+}
+
+func (o *operatorComponent) Cancel(ctx context.Context, txID string) (*component.TCCResp, error) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	o.phases = append(o.phases, PhaseCancel)
+	return o.mockComponent.Cancel(ctx, txID)
+}
+
+func (o *operatorComponent) setAccept(accept bool) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	o.accept = accept
+}
+
+func (o *operatorComponent) called() []Phase {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	return append([]Phase(nil), o.phases...)
+}
+
+// Test_OperatorRetry dead_letter 状态的事务在故障排除后通过 Retry 重新执行第二阶段并提交最终状态
+func Test_OperatorRetry(t *testing.T) {
+	txStore := NewMemTXStore()
+	txManager := NewTXManager(txStore, WithMonitorTick(time.Hour), WithMaxRecoveryAttempts(1), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+	c := &operatorComponent{mockComponent: mockComponent{id: "component", ack: true}}
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	txID := createTriedTXs(t, txStore, c.ID(), 1)[0]
+
+	// 1. confirm 被拒绝, 事务被置为 dead_letter 状态
+	tx, err := txManager.Retry(ctx, txID)
+	if err == nil {
+		t.Fatal("retry with rejected confirm should fail")
+	}
+	if tx, err = txManager.Inspect(ctx, txID); err != nil {
+		t.Fatal(err)
+	}
+	if tx.Status != TXDeadLetter || tx.LastError == "" {
+		t.Fatalf("tx status: %s last error: %q, want: %s with last error", tx.Status, tx.LastError, TXDeadLetter)
+	}
+
+	// 2. 故障排除后重新执行第二阶段
+	c.setAccept(true)
+	if tx, err = txManager.Retry(ctx, txID); err != nil {
+		t.Fatal(err)
+	}
+	if tx.Status != TXSuccessful {
+		t.Errorf("tx status: %s, want: %s", tx.Status, TXSuccessful)
+	}
+
+	// 3. 终态的事务不能再被人工介入
+	if _, err = txManager.Retry(ctx, txID); !errors.Is(err, ErrTXFinished) {
+		t.Errorf("retry err: %v, want: %v", err, ErrTXFinished)
+	}
+	if _, err = txManager.ForceCancel(ctx, txID, "rollback"); !errors.Is(err, ErrTXFinished) {
+		t.Errorf("force cancel err: %v, want: %v", err, ErrTXFinished)
+	}
+}
+
+// Test_OperatorForce 强制决议忽略组件的 try 状态, 并投递审计事件
+func Test_OperatorForce(t *testing.T) {
+	txStore := NewMemTXStore()
+	events := make(chan *Event, 16)
+	txManager := NewTXManager(txStore, WithMonitorTick(time.Hour), WithLogger(log.NewNopLogger()),
+		WithListener(ListenerFunc(func(event *Event) {
+			if event.Type == EventTXForced {
+				events <- event
+			}
+		})))
+	defer txManager.Stop()
+	c := &operatorComponent{mockComponent: mockComponent{id: "component", ack: true}, accept: true}
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// 1. 强制决议需要提供原因
+	txID, err := txStore.CreateTX(ctx, NewTransaction(ComponentEntities{{Component: c}}, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = txManager.ForceCancel(ctx, txID, " "); !errors.Is(err, ErrReasonRequired) {
+		t.Errorf("force cancel err: %v, want: %v", err, ErrReasonRequired)
+	}
+
+	// 2. try 结果未知的事务强制 cancel
+	tx, err := txManager.ForceCancel(ctx, txID, "component lost try request")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Status != TXFailure {
+		t.Errorf("tx status: %s, want: %s", tx.Status, TXFailure)
+	}
+	select {
+	case event := <-events:
+		if event.TXID != txID || event.Status != TXFailure || event.Reason != "component lost try request" {
+			t.Errorf("forced event: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Error("forced event not emitted")
+	}
+
+	// 3. try 失败的事务强制 confirm 需要显式确认
+	if txID, err = txStore.CreateTX(ctx, NewTransaction(ComponentEntities{{Component: c}}, time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err = txStore.TXUpdate(ctx, txID, c.ID(), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = txManager.ForceConfirm(ctx, txID, "try applied manually"); !errors.Is(err, ErrTryNotSucceeded) {
+		t.Errorf("force confirm err: %v, want: %v", err, ErrTryNotSucceeded)
+	}
+	if tx, err = txManager.ForceConfirm(ctx, txID, "try applied manually", WithForceOverride()); err != nil {
+		t.Fatal(err)
+	}
+	if tx.Status != TXSuccessful {
+		t.Errorf("tx status: %s, want: %s", tx.Status, TXSuccessful)
+	}
+
+	if phases := c.called(); len(phases) != 2 || phases[0] != PhaseCancel || phases[1] != PhaseConfirm {
+		t.Errorf("second phase calls: %v, want: [cancel confirm]", phases)
+	}
+}
+
+// Test_OperatorForcePersisted 强制决议以及原因随事务日志持久化, 推进中断后异步轮询流程遵循同一决议继续推进
+func Test_OperatorForcePersisted(t *testing.T) {
+	txStore := NewMemTXStore()
+	txManager := NewTXManager(txStore, WithMonitorTick(time.Hour), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+	a := &operatorComponent{mockComponent: mockComponent{id: "a", ack: true}, accept: true}
+	b := &operatorComponent{mockComponent: mockComponent{id: "b", ack: true}}
+	for _, c := range []*operatorComponent{a, b} {
+		if err := txManager.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+
+	// 1. 组件 b 的 try 结果未知, 强制 confirm 后 a confirm 成功, b confirm 失败
+	txID, err := txStore.CreateTX(ctx, NewTransaction(ComponentEntities{{Component: a}, {Component: b}}, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = txStore.TXUpdate(ctx, txID, a.ID(), true); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, err = txManager.ForceConfirm(ctx, txID, "b applied manually", WithForceOverride()); err == nil {
+		t.Fatal("force confirm should fail")
+	}
+	tx, err := txManager.Inspect(ctx, txID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Status != TXHanging || tx.ForcedStatus != TXSuccessful || tx.ForceReason != "b applied manually" {
+		t.Errorf("tx status: %s, forced: %s, reason: %s", tx.Status, tx.ForcedStatus, tx.ForceReason)
+	}
+
+	// 2. 不能再强制决议为不同的结果
+	if _, err = txManager.ForceCancel(ctx, txID, "rollback"); !errors.Is(err, ErrForceConflict) {
+		t.Errorf("force cancel err: %v, want: %v", err, ErrForceConflict)
+	}
+
+	// 3. 事务已经超过截止时间且 b 的 try 结果未知, 异步轮询流程仍然遵循持久化的决议 confirm, 不会 cancel 已经 confirm 的组件
+	b.setAccept(true)
+	if err = txManager.advanceProgressByTXID(txManager.ctx, txID); err != nil {
+		t.Fatal(err)
+	}
+	if tx, _ = txStore.GetTX(ctx, txID); tx.Status != TXSuccessful {
+		t.Errorf("tx status: %s, want: %s", tx.Status, TXSuccessful)
+	}
+	for _, c := range []*operatorComponent{a, b} {
+		for _, phase := range c.called() {
+			if phase != PhaseConfirm {
+				t.Errorf("component: %s second phase calls: %v, want confirm only", c.ID(), c.called())
+				break
+			}
+		}
+	}
+}
@@ -1,6 +1,13 @@
 package txmanager
 
-import "time"
+import (
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
 
 // Options TX Manager 事务协调器中的一个字段, 保存一些配置信息
 type Options struct {
@@ -8,8 +15,57 @@ type Options struct {
 	Timeout time.Duration
 	// 轮询监控任务间隔时长
 	MonitorTick time.Duration
+	// 日志实现, 默认使用 log 包的默认日志实现(标准输出)
+	Logger log.Logger
+	// 指标上报实现, 默认不上报任何指标
+	Metrics Metrics
+	// 链路追踪的 TracerProvider, 默认使用 otel 全局的 TracerProvider
+	TracerProvider trace.TracerProvider
+	// trace 上下文注入 TCCReq.Metadata 时使用的 Propagator, 默认使用 otel 全局的 TextMapPropagator
+	Propagator propagation.TextMapPropagator
+	// 事务生命周期事件的监听器
+	Listeners []Listener
+	// 事件缓冲队列的长度, 默认为 1024
+	ListenerBuffer int
+	// 组件调用拦截器链
+	Interceptors []Interceptor
+	// 第二阶段的执行模式, 默认为异步执行
+	SecondPhase SecondPhaseMode
+	// 异步轮询流程的选主模块, 默认基于 TXStore.Lock 实现
+	Elector Elector
+	// leader 租约的有效期, 默认为 MonitorTick 的3倍, leader 每隔 LeaseTTL/3 续约一次
+	LeaseTTL time.Duration
+	// 创建事务的节点在第一阶段期间持有的事务所有权租约的有效期, 默认为 MonitorTick 的3倍, 每隔 OwnerTTL/3 续约一次
+	// 租约到期之前异步轮询流程不会补发 Try, 节点宕机后至少经过 OwnerTTL 才会补发, 在此之前到达截止时间的事务直接失败
+	OwnerTTL time.Duration
+	// 分片恢复模式的分片总数, 为 0 时不开启分片恢复模式. 所有节点需要配置相同的分片总数
+	Shards int
+	// 分片恢复模式的协调模块
+	ShardCoordinator ShardCoordinator
+	// 节点 id, 用于分片恢复模式的成员管理, 默认由主机名、进程号以及启动时间生成
+	NodeID string
+	// 异步轮询流程单次从 TXStore 分页获取 hanging 事务的数量, 默认为 100
+	RecoveryBatch int
+	// 异步轮询流程同时推进的事务数量上限, 默认为 16
+	RecoveryConcurrency int
+	// 推进事务第二阶段的最大失败次数, 达到上限后事务被置为 dead_letter 状态, 为 0 时不限制
+	MaxRecoveryAttempts int
+	// 单笔事务推进失败后的重试间隔, 每次失败翻倍, 封顶为 MaxRecoveryBackoff. 默认为 MonitorTick
+	RecoveryBackoff time.Duration
+	// 单笔事务重试间隔的上限, 默认为 RecoveryBackoff 的8倍
+	MaxRecoveryBackoff time.Duration
 }
 
+// SecondPhaseMode 第二阶段(Confirm/Cancel 以及提交事务的最终状态)的执行模式
+type SecondPhaseMode string
+
+const (
+	// SecondPhaseAsync 第一阶段结束后立即返回, 第二阶段异步执行
+	SecondPhaseAsync SecondPhaseMode = "async"
+	// SecondPhaseSync 在事务的截止时间之内同步等待第二阶段执行完成后再返回, 适用于需要立即读取事务结果的场景
+	SecondPhaseSync SecondPhaseMode = "sync"
+)
+
 type Option func(*Options)
 
 // WithTimeout 暴露接口返回设置事务执行时长的函数
@@ -34,6 +90,127 @@ func WithMonitorTick(tick time.Duration) Option {
 	}
 }
 
+// WithLogger 注入 TXManager 使用的日志实现, 例如 log.NewNopLogger、log.NewStdoutLogger、log.NewFileLogger
+func WithLogger(logger log.Logger) Option {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
+
+// WithMetrics 注入 TXManager 使用的指标上报实现
+func WithMetrics(metrics Metrics) Option {
+	return func(o *Options) {
+		o.Metrics = metrics
+	}
+}
+
+// WithTracerProvider 注入 TXManager 创建 span 时使用的 TracerProvider
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(o *Options) {
+		o.TracerProvider = provider
+	}
+}
+
+// WithPropagator 注入 trace 上下文注入 TCCReq.Metadata 时使用的 Propagator, 例如 propagation.TraceContext{}
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(o *Options) {
+		o.Propagator = propagator
+	}
+}
+
+// WithListener 注册事务生命周期事件的监听器, 可以多次调用注册多个监听器
+func WithListener(listener Listener) Option {
+	return func(o *Options) {
+		o.Listeners = append(o.Listeners, listener)
+	}
+}
+
+// WithListenerBuffer 设置事件缓冲队列的长度, 队列已满时新产生的事件会被丢弃
+func WithListenerBuffer(size int) Option {
+	return func(o *Options) {
+		o.ListenerBuffer = size
+	}
+}
+
+// WithInterceptors 注入组件调用拦截器, 按照注入顺序执行, 可以多次调用
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(o *Options) {
+		o.Interceptors = append(o.Interceptors, interceptors...)
+	}
+}
+
+// WithSecondPhase 设置 TXManager 默认的第二阶段执行模式
+func WithSecondPhase(mode SecondPhaseMode) Option {
+	return func(o *Options) {
+		o.SecondPhase = mode
+	}
+}
+
+// WithElector 注入异步轮询流程的选主模块
+func WithElector(elector Elector) Option {
+	return func(o *Options) {
+		o.Elector = elector
+	}
+}
+
+// WithLeaseTTL 设置 leader 租约的有效期
+func WithLeaseTTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.LeaseTTL = ttl
+	}
+}
+
+// WithOwnerTTL 设置创建事务的节点在第一阶段期间持有的事务所有权租约的有效期
+func WithOwnerTTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.OwnerTTL = ttl
+	}
+}
+
+// WithShards 开启分片恢复模式, shards 为分片总数, coordinator 为分片协调模块
+func WithShards(shards int, coordinator ShardCoordinator) Option {
+	return func(o *Options) {
+		o.Shards = shards
+		o.ShardCoordinator = coordinator
+	}
+}
+
+// WithNodeID 设置节点 id, 节点 id 需要在所有节点之间保持唯一
+func WithNodeID(nodeID string) Option {
+	return func(o *Options) {
+		o.NodeID = nodeID
+	}
+}
+
+// WithRecoveryBatch 设置异步轮询流程分页获取 hanging 事务的单页数量
+func WithRecoveryBatch(batch int) Option {
+	return func(o *Options) {
+		o.RecoveryBatch = batch
+	}
+}
+
+// WithRecoveryConcurrency 设置异步轮询流程同时推进的事务数量上限
+func WithRecoveryConcurrency(concurrency int) Option {
+	return func(o *Options) {
+		o.RecoveryConcurrency = concurrency
+	}
+}
+
+// WithMaxRecoveryAttempts 设置推进事务第二阶段的最大失败次数
+func WithMaxRecoveryAttempts(attempts int) Option {
+	return func(o *Options) {
+		o.MaxRecoveryAttempts = attempts
+	}
+}
+
+// WithRecoveryBackoff 设置单笔事务推进失败后的重试间隔以及重试间隔上限
+func WithRecoveryBackoff(backoff, maxBackoff time.Duration) Option {
+	return func(o *Options) {
+		o.RecoveryBackoff = backoff
+		o.MaxRecoveryBackoff = maxBackoff
+	}
+}
+
 // repair 要是没有设置轮询监控任务间隔时长和事务执行时长 就会赋值默认值
 func repair(o *Options) {
 	// 轮询监控任务间隔时长为10s
@@ -45,4 +222,203 @@ func repair(o *Options) {
 	if o.Timeout <= 0 {
 		o.Timeout = 5 * time.Second
 	}
+
+	// 未注入日志实现时使用默认日志实现
+	if o.Logger == nil {
+		o.Logger = log.GetDefaultLogger()
+	}
+	if o.Metrics == nil {
+		o.Metrics = nopMetrics{}
+	}
+	if o.TracerProvider == nil {
+		o.TracerProvider = otel.GetTracerProvider()
+	}
+	if o.Propagator == nil {
+		o.Propagator = otel.GetTextMapPropagator()
+	}
+	if o.ListenerBuffer <= 0 {
+		o.ListenerBuffer = 1024
+	}
+	if o.SecondPhase == "" {
+		o.SecondPhase = SecondPhaseAsync
+	}
+	if o.LeaseTTL <= 0 {
+		o.LeaseTTL = 3 * o.MonitorTick
+	}
+	if o.OwnerTTL <= 0 {
+		o.OwnerTTL = 3 * o.MonitorTick
+	}
+	// 未注入分片协调模块时无法开启分片恢复模式
+	if o.Shards < 0 || o.ShardCoordinator == nil {
+		o.Shards = 0
+	}
+	if o.NodeID == "" {
+		o.NodeID = defaultNodeID()
+	}
+	if o.RecoveryBatch <= 0 {
+		o.RecoveryBatch = 100
+	}
+	if o.RecoveryConcurrency <= 0 {
+		o.RecoveryConcurrency = 16
+	}
+	if o.MaxRecoveryAttempts < 0 {
+		o.MaxRecoveryAttempts = 0
+	}
+	if o.RecoveryBackoff <= 0 {
+		o.RecoveryBackoff = o.MonitorTick
+	}
+	if o.MaxRecoveryBackoff < o.RecoveryBackoff {
+		o.MaxRecoveryBackoff = o.RecoveryBackoff << 3
+	}
+}
+
+// TXOptions 单笔事务的配置项, 通过 TXManager.TransactionWithOptions、TXManager.ExecuteWithOptions、TXManager.Submit 的 opts 注入
+type TXOptions struct {
+	// 事务执行时长限制, 未设置时使用 TXManager 的 Timeout
+	Timeout time.Duration
+	// 第二阶段的执行模式, 未设置时使用 TXManager 的 SecondPhase
+	SecondPhase SecondPhaseMode
+}
+
+type TXOption func(*TXOptions)
+
+// WithTXTimeout 设置单笔事务的执行时长限制, 事务的截止时间会随事务日志持久化
+func WithTXTimeout(timeout time.Duration) TXOption {
+	return func(o *TXOptions) {
+		o.Timeout = timeout
+	}
+}
+
+// WithTXSecondPhase 设置单笔事务的第二阶段执行模式
+func WithTXSecondPhase(mode SecondPhaseMode) TXOption {
+	return func(o *TXOptions) {
+		o.SecondPhase = mode
+	}
+}
+
+// repairTXOptions 未设置的配置项使用 TXManager 的配置
+func repairTXOptions(o *TXOptions, opts *Options) {
+	if o.Timeout <= 0 {
+		o.Timeout = opts.Timeout
+	}
+	if o.SecondPhase == "" {
+		o.SecondPhase = opts.SecondPhase
+	}
+}
+
+// ForceOptions 强制决议的配置项, 通过 TXManager.ForceConfirm、TXManager.ForceCancel 的 opts 注入
+type ForceOptions struct {
+	// 是否允许对存在 try 未成功的组件的事务强制 confirm, 默认不允许
+	// 此时 try 失败或者未执行的组件同样会被 confirm, 需要运维人员确认组件的资源已经人工补齐
+	Override bool
+}
+
+type ForceOption func(*ForceOptions)
+
+// WithForceOverride 允许对存在 try 未成功的组件的事务强制 confirm
+func WithForceOverride() ForceOption {
+	return func(o *ForceOptions) {
+		o.Override = true
+	}
+}
+
+// ComponentOptions 组件级别的调用配置
+// 1. 可以在 Register、RegisterSaga 时通过 ComponentOption 注入, 也可以由组件实现 ComponentOptionsProvider 自行声明
+// 2. Saga 组件的正向操作 Action 适用 try 阶段的配置, 补偿操作 Compensate 适用 cancel 阶段的配置
+type ComponentOptions struct {
+	// try 单次调用的超时时长, 为 0 时不单独限制, 但仍受事务截止时间的限制
+	TryTimeout time.Duration
+	// confirm 单次调用的超时时长, 默认为 TXManager 的 Timeout
+	ConfirmTimeout time.Duration
+	// cancel 单次调用的超时时长, 默认为 TXManager 的 Timeout
+	CancelTimeout time.Duration
+	// 调用出错时的最大尝试次数(包含首次调用), 默认为 1 即不重试. 组件明确拒绝请求时不会重试
+	MaxAttempts int
+	// 重试前的退避时长, 每次重试翻倍, 封顶为 MaxBackoff
+	Backoff time.Duration
+	// 退避时长上限, 默认为 Backoff 的8倍
+	MaxBackoff time.Duration
+}
+
+// timeout 返回组件在指定阶段单次调用的超时时长
+func (c *ComponentOptions) timeout(phase Phase) time.Duration {
+	switch phase {
+	case PhaseConfirm:
+		return c.ConfirmTimeout
+	case PhaseCancel:
+		return c.CancelTimeout
+	default:
+		return c.TryTimeout
+	}
+}
+
+type ComponentOption func(*ComponentOptions)
+
+// ComponentOptionsProvider 组件可以选择实现该接口声明自身的调用配置, Register 时传入的 ComponentOption 会在其基础上覆盖
+type ComponentOptionsProvider interface {
+	ComponentOptions() ComponentOptions
+}
+
+// WithTryTimeout 设置组件 try 单次调用的超时时长
+func WithTryTimeout(timeout time.Duration) ComponentOption {
+	return func(o *ComponentOptions) {
+		o.TryTimeout = timeout
+	}
+}
+
+// WithConfirmTimeout 设置组件 confirm 单次调用的超时时长
+func WithConfirmTimeout(timeout time.Duration) ComponentOption {
+	return func(o *ComponentOptions) {
+		o.ConfirmTimeout = timeout
+	}
+}
+
+// WithCancelTimeout 设置组件 cancel 单次调用的超时时长
+func WithCancelTimeout(timeout time.Duration) ComponentOption {
+	return func(o *ComponentOptions) {
+		o.CancelTimeout = timeout
+	}
+}
+
+// WithMaxAttempts 设置组件调用出错时的最大尝试次数
+func WithMaxAttempts(attempts int) ComponentOption {
+	return func(o *ComponentOptions) {
+		o.MaxAttempts = attempts
+	}
+}
+
+// WithBackoff 设置组件重试的退避时长以及退避时长上限
+func WithBackoff(backoff, maxBackoff time.Duration) ComponentOption {
+	return func(o *ComponentOptions) {
+		o.Backoff = backoff
+		o.MaxBackoff = maxBackoff
+	}
+}
+
+// newComponentOptions 合并组件自身声明的配置以及注册时传入的配置, 未设置的配置项赋值默认值
+func newComponentOptions(c interface{}, opts *Options, componentOpts ...ComponentOption) *ComponentOptions {
+	o := ComponentOptions{}
+	if provider, ok := c.(ComponentOptionsProvider); ok {
+		o = provider.ComponentOptions()
+	}
+	for _, opt := range componentOpts {
+		opt(&o)
+	}
+
+	if o.ConfirmTimeout <= 0 {
+		o.ConfirmTimeout = opts.Timeout
+	}
+	if o.CancelTimeout <= 0 {
+		o.CancelTimeout = opts.Timeout
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 1
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = 100 * time.Millisecond
+	}
+	if o.MaxBackoff < o.Backoff {
+		o.MaxBackoff = o.Backoff << 3
+	}
+	return &o
 }
@@ -0,0 +1,195 @@
+package txmanager
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+// recordConfirmComponent 记录 confirm 的调用顺序以及同时执行的 confirm 请求数量的峰值
+type recordConfirmComponent struct {
+	mockComponent
+	mux      sync.Mutex
+	txIDs    []string
+	inflight int
+	peak     int
+}
+
+func (r *recordConfirmComponent) Confirm(ctx context.Context, txID string) (*component.TCCResp, error) {
+	r.mux.Lock()
+	r.txIDs = append(r.txIDs, txID)
+	if r.inflight++; r.inflight > r.peak {
+		r.peak = r.inflight
+	}
+	r.mux.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	r.mux.Lock()
+	r.inflight--
+	r.mux.Unlock()
+	return r.mockComponent.Confirm(ctx, txID)
+}
+
+// createTriedTXs 创建 n 笔 try 成功的 hanging 事务, 按照创建顺序返回事务 id
+func createTriedTXs(t *testing.T, txStore TXStore, componentID string, n int) []string {
+	ctx := context.Background()
+	txIDs := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		txID, err := txStore.CreateTX(ctx, NewTransaction(ComponentEntities{{Component: &mockComponent{id: componentID}}}, time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = txStore.TXUpdate(ctx, txID, componentID, true); err != nil {
+			t.Fatal(err)
+		}
+		txIDs = append(txIDs, txID)
+	}
+	return txIDs
+}
+
+// Test_RecoveryWorkerPool 异步轮询流程分页获取 hanging 事务, 同时推进的事务数量不超过 RecoveryConcurrency
+func Test_RecoveryWorkerPool(t *testing.T) {
+	txStore := NewMemTXStore()
+	c := &recordConfirmComponent{mockComponent: mockComponent{id: "component", ack: true}}
+	txIDs := createTriedTXs(t, txStore, c.ID(), 40)
+
+	metrics := newRecordMetrics()
+	txManager := NewTXManager(txStore, WithMonitorTick(10*time.Millisecond), WithRecoveryBatch(7), WithRecoveryConcurrency(4),
+		WithElector(NewMemElector()), WithMetrics(metrics), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFinalized(t, txStore, txIDs)
+	// 第一轮推进跨越多页, 上报的是全部分页的事务总数
+	waitCounter(t, metrics, "hanging_txs", len(txIDs))
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.peak > 4 {
+		t.Errorf("peak concurrency: %d, want at most: 4", c.peak)
+	}
+	if c.peak < 2 {
+		t.Errorf("peak concurrency: %d, want concurrent recovery", c.peak)
+	}
+}
+
+// Test_RecoveryOldestFirst 异步轮询流程按照创建时间由早到晚推进 hanging 事务
+func Test_RecoveryOldestFirst(t *testing.T) {
+	txStore := NewMemTXStore()
+	c := &recordConfirmComponent{mockComponent: mockComponent{id: "component", ack: true}}
+	txIDs := createTriedTXs(t, txStore, c.ID(), 10)
+
+	txManager := NewTXManager(txStore, WithMonitorTick(10*time.Millisecond), WithRecoveryBatch(3), WithRecoveryConcurrency(1),
+		WithElector(NewMemElector()), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFinalized(t, txStore, txIDs)
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if len(c.txIDs) != len(txIDs) {
+		t.Fatalf("confirmed txs: %v, want: %v", c.txIDs, txIDs)
+	}
+	for i := range txIDs {
+		if c.txIDs[i] != txIDs[i] {
+			t.Fatalf("confirmed txs: %v, want: %v", c.txIDs, txIDs)
+		}
+	}
+}
+
+// waitFinalized 等待所有事务的最终状态提交成功
+func waitFinalized(t *testing.T, txStore TXStore, txIDs []string) {
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		txs, _, err := txStore.GetHangingTXs(context.Background(), HangingQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(txs) == 0 {
+			return
+		}
+	}
+	t.Fatalf("txs not finalized: %v", txIDs)
+}
+
+// nackConfirmComponent 始终拒绝 confirm 请求, 并记录每次 confirm 的时间
+type nackConfirmComponent struct {
+	mockComponent
+	mux   sync.Mutex
+	calls []time.Time
+}
+
+func (n *nackConfirmComponent) Confirm(ctx context.Context, txID string) (*component.TCCResp, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.calls = append(n.calls, time.Now())
+	return &component.TCCResp{ComponentID: n.id, TXID: txID, ACK: false}, nil
+}
+
+// Test_RecoveryDeadLetter 事务按照自身的退避策略重试, 失败次数达到上限后被置为 dead_letter 状态
+func Test_RecoveryDeadLetter(t *testing.T) {
+	txStore := NewMemTXStore()
+	c := &nackConfirmComponent{mockComponent: mockComponent{id: "component", ack: true}}
+	txIDs := createTriedTXs(t, txStore, c.ID(), 1)
+
+	metrics := newRecordMetrics()
+	events := make(chan *Event, 16)
+	txManager := NewTXManager(txStore, WithMonitorTick(5*time.Millisecond), WithMaxRecoveryAttempts(3),
+		WithRecoveryBackoff(30*time.Millisecond, time.Second), WithElector(NewMemElector()), WithMetrics(metrics),
+		WithListener(ListenerFunc(func(event *Event) {
+			if event.Type == EventTXFinalized {
+				events <- event
+			}
+		})), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	result, err := txManager.Handle(txIDs[0]).Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != TXDeadLetter {
+		t.Fatalf("tx status: %s, want: %s", result.Status, TXDeadLetter)
+	}
+
+	tx, err := txStore.GetTX(context.Background(), txIDs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.LastError == "" {
+		t.Error("last error not recorded")
+	}
+	select {
+	case event := <-events:
+		if event.Status != TXDeadLetter || event.Err == nil {
+			t.Errorf("finalized event status: %s err: %v", event.Status, event.Err)
+		}
+	case <-time.After(time.Second):
+		t.Error("finalized event not emitted")
+	}
+	waitCounter(t, metrics, "tx_finished_tcc_dead_letter_false", 1)
+
+	// 第 n 次失败后的重试间隔为 RecoveryBackoff * 2^(n-1), 达到上限后不再重试
+	time.Sleep(50 * time.Millisecond)
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if len(c.calls) != 3 {
+		t.Fatalf("confirm calls: %d, want: 3", len(c.calls))
+	}
+	for i, want := range []time.Duration{30 * time.Millisecond, 60 * time.Millisecond} {
+		if gap := c.calls[i+1].Sub(c.calls[i]); gap < want {
+			t.Errorf("retry %d gap: %v, want at least: %v", i+1, gap, want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package txmanager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+// Saga 模式
+// 1. 适用于无法提供 Try 资源预留能力的下游服务, 组件只需要提供正向操作 Action 和补偿操作 Compensate
+// 2. 执行流程:
+//  2.1 按照组件间依赖关系的拓扑顺序依次执行各组件的正向操作, 一旦某个组件失败则不再继续向后执行
+//  2.2 所有正向操作均成功时, 直接提交事务状态为成功
+//  2.3 存在正向操作失败(或事务超时)时, 逆序对已执行的组件执行补偿操作, 再提交事务状态为失败
+// 3. 与 TCC 模式复用 TXStore 事务日志、registryCenter 注册中心以及 run 异步轮询流程
+//    各组件正向操作的执行结果同样通过 TXUpdate 记录在 ComponentTryEntity 中
+
+// sagaCommit 针对 Saga 模式的事务顺序执行各组件的正向操作
+func (t *TXManager) sagaCommit(ctx context.Context, txID string, componentEntities ComponentEntities) *TXResult {
+	result := newTXResult(txID, componentEntities)
+	result.Status = TXSuccessful
+	// 1. 按照拓扑顺序依次执行各组件的正向操作
+	for i, componentEntity := range componentEntities {
+		componentResult := result.Components[i]
+		req := &component.TCCReq{ComponentID: componentEntity.ID(), TXID: txID, Data: componentEntity.Request}
+		resp, err := t.invoke(ctx, PhaseTry, req, componentEntity.Saga.Action)
+		t.emit(ctx, &Event{Type: EventComponentTried, TXID: txID, Mode: TXModeSaga, ComponentID: componentEntity.ID(), Phase: PhaseTry, Request: componentEntity.Request, ACK: acked(resp, err), Err: err})
+		// 1.1 正向操作报错或者拒绝, 整个事务都需要进行补偿, 但会放在 advanceProgressByTXID 流程处理
+		if err != nil || !resp.ACK {
+			t.logger(ctx).Errorw("tx action failed", log.KeyComponentID, componentEntity.ID(), "err", err)
+			componentResult.TryStatus = TryFailure
+			if componentResult.Err = err; err == nil {
+				componentResult.Err = ErrTryRejected
+			}
+			result.Status = t.persistSagaFailure(ctx, txID, componentEntity.ID())
+			break
+		}
+		// 1.2 正向操作成功，但是请求结果更新到事务日志失败时，也需要视为处理失败
+		// 事务日志中该组件仍为 hanging 状态, 需要将其标记为失败, 避免异步轮询流程重新发起正向操作后提交事务
+		if err = t.txStore.TXUpdate(ctx, txID, componentEntity.ID(), true); err != nil {
+			t.logger(ctx).Errorw("tx updated failed", log.KeyComponentID, componentEntity.ID(), "err", err)
+			componentResult.TryStatus = TryFailure
+			componentResult.Err = err
+			result.Status = t.persistSagaFailure(ctx, txID, componentEntity.ID())
+			break
+		}
+		componentResult.TryStatus = TrySucceesful
+	}
+
+	// 2. 由 prepare 推进事务进度: 成功时提交事务, 失败时逆序执行补偿操作
+	return result
+}
+
+// persistSagaFailure 将正向操作失败的组件在事务日志中标记为失败, 返回事务当前的状态
+//  1. 标记成功时, 异步轮询流程据此执行补偿而非重新发起正向操作, 事务状态为失败
+//  2. 事务的截止时间已过时, 事务日志中存在 hanging 组件的事务必然被判定为失败, 无需再标记
+//  3. 标记失败时事务的成败无法确定, 事务状态为 hanging, 交由异步轮询流程决议
+func (t *TXManager) persistSagaFailure(ctx context.Context, txID, componentID string) TXStatus {
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return TXFailure
+	}
+	if err := t.txStore.TXUpdate(ctx, txID, componentID, false); err != nil {
+		t.logger(ctx).Errorw("persist tx failure failed", log.KeyComponentID, componentID, "err", err)
+		return TXHanging
+	}
+	return TXFailure
+}
+
+// retrySagaActions 基于事务日志中持久化的请求参数, 按照拓扑顺序补发仍处于 hanging 状态的正向操作
+// 仅在创建事务的节点的所有权租约到期后由 retryHangingTries 调用, 补发的正向操作不会与原始的第一阶段并发
+func (t *TXManager) retrySagaActions(ctx context.Context, txID string, sortedComponents []*ComponentTryEntity) {
+	for _, componentEntity := range sortedComponents {
+		if componentEntity.TryStatus == TrySucceesful {
+			continue
+		}
+		// 前序组件未执行成功时, 后续组件不能执行
+		if componentEntity.TryStatus != TryHanging {
+			return
+		}
+
+		components, err := t.registryCenter.getSagaComponents(componentEntity.ComponentID)
+		if err != nil || len(components) == 0 {
+			t.logger(ctx).Errorw("get saga component failed", log.KeyComponentID, componentEntity.ComponentID, "err", err)
+			return
+		}
+
+		req := &component.TCCReq{ComponentID: componentEntity.ComponentID, TXID: txID, Data: componentEntity.Request}
+		resp, err := t.invoke(ctx, PhaseTry, req, components[0].Action)
+		t.emit(ctx, &Event{Type: EventComponentTried, TXID: txID, Mode: TXModeSaga, ComponentID: componentEntity.ComponentID, Phase: PhaseTry, Request: componentEntity.Request, ACK: acked(resp, err), Err: err})
+		// 请求出错时无法判定正向操作的结果, 保持 hanging 状态等待下一轮推进
+		if err != nil {
+			t.logger(ctx).Errorw("tx retry action failed", log.KeyComponentID, componentEntity.ComponentID, "err", err)
+			return
+		}
+
+		if err = t.txStore.TXUpdate(ctx, txID, componentEntity.ComponentID, resp.ACK); err != nil {
+			t.logger(ctx).Errorw("tx updated failed", log.KeyComponentID, componentEntity.ComponentID, "err", err)
+			return
+		}
+		if !resp.ACK {
+			componentEntity.TryStatus = TryFailure
+			return
+		}
+		componentEntity.TryStatus = TrySucceesful
+	}
+}
+
+// advanceSagaProgress 推进 Saga 模式事务的进度
+func (t *TXManager) advanceSagaProgress(ctx context.Context, tx *Transaction, success bool) error {
+	// 1. 所有正向操作均已成功, 直接提交事务
+	if success {
+		return t.submit(ctx, tx, true)
+	}
+
+	// 2. 找出实际执行到的组件: 拓扑顺序中首个未成功的组件及其之前的组件, 后续组件的正向操作不会被执行
+	sortedComponents, err := tx.sortedComponents()
+	if err != nil {
+		return err
+	}
+	executed := len(sortedComponents)
+	for i, componentEntity := range sortedComponents {
+		if componentEntity.TryStatus != TrySucceesful {
+			executed = i + 1
+			break
+		}
+	}
+
+	// 3. 逆序执行补偿操作
+	for i := executed - 1; i >= 0; i-- {
+		componentEntity := sortedComponents[i]
+		components, err := t.registryCenter.getSagaComponents(componentEntity.ComponentID)
+		if err != nil || len(components) == 0 {
+			return fmt.Errorf("get saga component failed, component id: %s", componentEntity.ComponentID)
+		}
+
+		req := &component.TCCReq{ComponentID: componentEntity.ComponentID, TXID: tx.TXID, Data: componentEntity.Request}
+		resp, err := t.invoke(ctx, PhaseCancel, req, components[0].Compensate)
+		t.emit(ctx, &Event{Type: EventComponentCancelled, TXID: tx.TXID, Mode: TXModeSaga, ComponentID: componentEntity.ComponentID, Phase: PhaseCancel, ACK: acked(resp, err), Err: err})
+		if err != nil {
+			return err
+		}
+		if !resp.ACK {
+			return fmt.Errorf("component: %s ack failed", componentEntity.ComponentID)
+		}
+	}
+
+	// 4. 补偿操作都执行完成后，提交事务状态为失败
+	return t.submit(ctx, tx, false)
+}
+
+// getSagaComponents 拼接 Saga 组件实体列表
+func (t *TXManager) getSagaComponents(idToReq map[string]*RequestEntity, componentIDs []string) (ComponentEntities, error) {
+	components, err := t.registryCenter.getSagaComponents(componentIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	entities := make(ComponentEntities, 0, len(components))
+	for _, component := range components {
+		entities = append(entities, &ComponentEntity{
+			Request:   idToReq[component.ID()].Request,
+			DependsOn: idToReq[component.ID()].DependsOn,
+			Saga:      component,
+		})
+	}
+
+	return entities, nil
+}
@@ -0,0 +1,285 @@
+package txmanager
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+// sagaRecorder 按照调用顺序记录各 Saga 组件的正向操作以及补偿操作
+type sagaRecorder struct {
+	mux   sync.Mutex
+	calls []string
+}
+
+func (s *sagaRecorder) record(call string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.calls = append(s.calls, call)
+}
+
+func (s *sagaRecorder) called() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+// mockSagaComponent 仅用于单测的 Saga 组件, 根据 ack 决定正向操作是否被拒绝
+type mockSagaComponent struct {
+	id       string
+	ack      bool
+	recorder *sagaRecorder
+}
+
+func (m *mockSagaComponent) ID() string {
+	return m.id
+}
+
+func (m *mockSagaComponent) Action(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+	m.recorder.record(m.id + ":action:" + toString(req.Data["biz_id"]))
+	return &component.TCCResp{ComponentID: m.id, TXID: req.TXID, ACK: m.ack}, nil
+}
+
+func (m *mockSagaComponent) Compensate(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+	m.recorder.record(m.id + ":compensate")
+	return &component.TCCResp{ComponentID: m.id, TXID: req.TXID, ACK: true}, nil
+}
+
+func toString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// newSagaManager 构造注册了 a、b、c 三个 Saga 组件的 TXManager, failed 中的组件正向操作失败
+func newSagaManager(t *testing.T, txStore TXStore, recorder *sagaRecorder, failed ...string) *TXManager {
+	txManager := NewTXManager(txStore, WithMonitorTick(time.Hour), WithSecondPhase(SecondPhaseSync), WithLogger(log.NewNopLogger()))
+	for _, id := range []string{"a", "b", "c"} {
+		c := &mockSagaComponent{id: id, ack: true, recorder: recorder}
+		for _, f := range failed {
+			c.ack = c.ack && f != id
+		}
+		if err := txManager.RegisterSaga(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return txManager
+}
+
+func sagaReqs() []*RequestEntity {
+	return []*RequestEntity{
+		{ComponentID: "a", Request: map[string]interface{}{"biz_id": "1"}},
+		{ComponentID: "b", Request: map[string]interface{}{"biz_id": "2"}},
+		{ComponentID: "c", Request: map[string]interface{}{"biz_id": "3"}},
+	}
+}
+
+// Test_SagaCommit 按照声明顺序依次执行正向操作, 全部成功时直接提交事务, 不执行补偿操作
+func Test_SagaCommit(t *testing.T) {
+	txStore, recorder := NewMemTXStore(), &sagaRecorder{}
+	txManager := newSagaManager(t, txStore, recorder)
+	defer txManager.Stop()
+
+	result, err := txManager.Execute(context.Background(), sagaReqs()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Successful() || !result.Finalized {
+		t.Errorf("tx status: %s, finalized: %t", result.Status, result.Finalized)
+	}
+	if want := []string{"a:action:1", "b:action:2", "c:action:3"}; !reflect.DeepEqual(recorder.called(), want) {
+		t.Errorf("calls: %v, want: %v", recorder.called(), want)
+	}
+	if tx, _ := txStore.GetTX(context.Background(), result.TXID); tx.Mode != TXModeSaga || tx.Status != TXSuccessful {
+		t.Errorf("tx mode: %s, status: %s", tx.Mode, tx.Status)
+	}
+}
+
+// Test_SagaCompensate 正向操作失败时不再执行后续组件, 并逆序对已执行的组件执行补偿操作
+func Test_SagaCompensate(t *testing.T) {
+	txStore, recorder := NewMemTXStore(), &sagaRecorder{}
+	txManager := newSagaManager(t, txStore, recorder, "b")
+	defer txManager.Stop()
+
+	result, err := txManager.Execute(context.Background(), sagaReqs()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != TXFailure || !result.Finalized {
+		t.Errorf("tx status: %s, finalized: %t", result.Status, result.Finalized)
+	}
+	want := map[string]ComponentTryStatus{"a": TrySucceesful, "b": TryFailure, "c": TryHanging}
+	for _, componentResult := range result.Components {
+		if componentResult.TryStatus != want[componentResult.ComponentID] {
+			t.Errorf("component: %s status: %s, want: %s", componentResult.ComponentID, componentResult.TryStatus, want[componentResult.ComponentID])
+		}
+	}
+	// 失败的组件同样需要补偿, 由组件的空补偿能力保证正确性
+	if want := []string{"a:action:1", "b:action:2", "b:compensate", "a:compensate"}; !reflect.DeepEqual(recorder.called(), want) {
+		t.Errorf("calls: %v, want: %v", recorder.called(), want)
+	}
+	if tx, _ := txStore.GetTX(context.Background(), result.TXID); tx.Status != TXFailure {
+		t.Errorf("tx status: %s, want: %s", tx.Status, TXFailure)
+	}
+}
+
+// Test_SagaRecovery 创建事务的节点在执行正向操作期间宕机后, 异步轮询流程基于持久化的请求参数按序补发正向操作
+func Test_SagaRecovery(t *testing.T) {
+	tests := []struct {
+		name   string
+		failed []string
+		status TXStatus
+		calls  []string
+	}{
+		{name: "successful", status: TXSuccessful, calls: []string{"b:action:2", "c:action:3"}},
+		{name: "compensate", failed: []string{"c"}, status: TXFailure, calls: []string{"b:action:2", "c:action:3", "c:compensate", "b:compensate", "a:compensate"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txStore, recorder := NewMemTXStore(), &sagaRecorder{}
+			txManager := newSagaManager(t, txStore, recorder, tt.failed...)
+			defer txManager.Stop()
+
+			// 模拟组件 a 的正向操作执行成功后宕机的节点
+			entities := make(ComponentEntities, 0, 3)
+			for _, req := range sagaReqs() {
+				entities = append(entities, &ComponentEntity{Request: req.Request, Saga: &mockSagaComponent{id: req.ComponentID}})
+			}
+			ctx := context.Background()
+			txID, err := txStore.CreateTX(ctx, NewTransaction(entities, time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = txStore.TXUpdate(ctx, txID, "a", true); err != nil {
+				t.Fatal(err)
+			}
+
+			if err = txManager.advanceProgressByTXID(txManager.ctx, txID); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(recorder.called(), tt.calls) {
+				t.Errorf("calls: %v, want: %v", recorder.called(), tt.calls)
+			}
+			if tx, _ := txStore.GetTX(ctx, txID); tx.Status != tt.status {
+				t.Errorf("tx status: %s, want: %s", tx.Status, tt.status)
+			}
+		})
+	}
+}
+
+// ownedSagaComponent 首次正向操作在 release 关闭之前阻塞并最终被拒绝, 模拟仍在执行第一阶段的节点; 补发的正向操作均被接受
+type ownedSagaComponent struct {
+	mockSagaComponent
+	once    sync.Once
+	started chan struct{}
+	release chan struct{}
+}
+
+func (o *ownedSagaComponent) Action(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+	var first bool
+	o.once.Do(func() { first = true })
+	resp, err := o.mockSagaComponent.Action(ctx, req)
+	if !first {
+		return resp, err
+	}
+	close(o.started)
+	<-o.release
+	return &component.TCCResp{ComponentID: o.id, TXID: req.TXID, ACK: false}, nil
+}
+
+// Test_SagaRecoveryOwned 创建事务的节点仍在执行正向操作时, 异步轮询流程不能补发正向操作, 否则补发的结果会覆盖原始的决议
+func Test_SagaRecoveryOwned(t *testing.T) {
+	txStore, recorder := NewMemTXStore(), &sagaRecorder{}
+	// 所有权租约的有效期短于正向操作的耗时, 依赖创建事务的节点在第一阶段期间续约
+	txManager := NewTXManager(txStore, WithMonitorTick(time.Hour), WithOwnerTTL(30*time.Millisecond), WithSecondPhase(SecondPhaseSync), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+
+	c := &ownedSagaComponent{
+		mockSagaComponent: mockSagaComponent{id: "a", ack: true, recorder: recorder},
+		started:           make(chan struct{}),
+		release:           make(chan struct{}),
+	}
+	if err := txManager.RegisterSaga(c); err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan *TXResult, 1)
+	go func() {
+		result, _ := txManager.Execute(context.Background(), sagaReqs()[0])
+		results <- result
+	}()
+	<-c.started
+	time.Sleep(100 * time.Millisecond)
+
+	// 异步轮询流程在第一阶段执行期间推进同一笔事务
+	if err := txManager.advanceProgressByTXID(txManager.ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	close(c.release)
+
+	result := <-results
+	if result == nil || result.Status != TXFailure {
+		t.Fatalf("tx result: %+v, want status: %s", result, TXFailure)
+	}
+	if want := []string{"a:action:1", "a:compensate"}; !reflect.DeepEqual(recorder.called(), want) {
+		t.Errorf("calls: %v, want: %v", recorder.called(), want)
+	}
+	if tx, _ := txStore.GetTX(context.Background(), result.TXID); tx.Status != TXFailure {
+		t.Errorf("tx status: %s, want: %s", tx.Status, TXFailure)
+	}
+}
+
+// Test_SagaUpdateFailedNotReplayed 正向操作成功但结果写入事务日志失败时, 事务判定为失败, 异步轮询流程不能重新发起正向操作
+func Test_SagaUpdateFailedNotReplayed(t *testing.T) {
+	txStore, recorder := &acceptUpdateFailedTXStore{MemTXStore: NewMemTXStore()}, &sagaRecorder{}
+	txManager := newSagaManager(t, txStore, recorder)
+	defer txManager.Stop()
+
+	result, err := txManager.Execute(context.Background(), sagaReqs()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != TXFailure {
+		t.Fatalf("tx status: %s, want: %s", result.Status, TXFailure)
+	}
+
+	// 异步轮询流程再次推进同一笔事务
+	if err = txManager.advanceProgressByTXID(txManager.ctx, result.TXID); err != nil {
+		t.Fatal(err)
+	}
+	// 组件 a 仅执行一次正向操作, 之后只会执行补偿操作
+	for i, call := range recorder.called() {
+		if (i == 0) != (call == "a:action:1") || (i > 0 && call != "a:compensate") {
+			t.Errorf("calls: %v, want action of a followed by compensations", recorder.called())
+			break
+		}
+	}
+	if tx, _ := txStore.GetTX(context.Background(), result.TXID); tx.Status != TXFailure {
+		t.Errorf("tx status: %s, want: %s", tx.Status, TXFailure)
+	}
+}
+
+// Test_SagaUpdateFailedUndecided 失败的决议同样无法写入事务日志时, 事务的成败交由异步轮询流程决议
+func Test_SagaUpdateFailedUndecided(t *testing.T) {
+	txStore, recorder := &acceptUpdateFailedTXStore{MemTXStore: NewMemTXStore(), failAll: true}, &sagaRecorder{}
+	txManager := newSagaManager(t, txStore, recorder)
+	defer txManager.Stop()
+
+	result, err := txManager.Execute(context.Background(), sagaReqs()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != TXHanging || result.Finalized || result.FinalizeErr == nil {
+		t.Errorf("tx status: %s, finalized: %t, err: %v", result.Status, result.Finalized, result.FinalizeErr)
+	}
+
+	// Transaction 不能将未决议的事务报告为失败
+	if success, err := txManager.Transaction(context.Background(), sagaReqs()...); success || !errors.Is(err, ErrUndecided) {
+		t.Errorf("tx success: %t, err: %v, want: %v", success, err, ErrUndecided)
+	}
+}
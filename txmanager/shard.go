@@ -0,0 +1,246 @@
+package txmanager
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+// 分片恢复模式
+// 1. 通过 WithShards 开启, 事务按照 ShardOf(txID, 分片总数) 划分到固定数量的分片中
+// 2. 每个分片各自选主: 节点通过 ShardCoordinator.Elector(shard) 取得分片的租约后, 只推进属于该分片的 hanging 事务,
+//    多个节点可以同时推进不同分片的事务, 异步轮询流程的吞吐随节点数量水平扩展
+// 3. 分片的分配:
+//  3.1 节点每个 MonitorTick 通过 ShardCoordinator.Heartbeat 上报存活, 并基于 Members 返回的存活节点列表,
+//      按照最高随机权重(rendezvous hashing)计算每个分片期望的归属节点
+//  3.2 节点竞争期望归属于自己的分片的租约, 主动放弃不再归属于自己的分片的租约
+//  3.3 节点加入时只有少量分片需要迁移; 节点离开时主动放弃全部租约, 异常退出时租约过期后由其他节点接管
+// 4. 分片的租约与 leader 租约的语义相同, 同样通过 LeaseTTL/3 的间隔续约, 推进流程的 ctx 中携带分片租约的 fencing token
+
+// ShardOf 返回事务所属的分片, 分片编号的取值范围为 [0, totalShards)
+// 分片基于事务 id 的 CRC32(IEEE) 计算, TXStore 的实现可以在存储层使用相同的算法过滤, 例如 MySQL 的 CRC32(id) % totalShards
+func ShardOf(txID string, totalShards int) int {
+	if totalShards <= 1 {
+		return 0
+	}
+	return int(crc32.ChecksumIEEE([]byte(txID)) % uint32(totalShards))
+}
+
+// HangingQuery GetHangingTXs 的查询条件, 零值表示不做任何过滤并一次返回全部事务
+type HangingQuery struct {
+	// 分片总数, 大于 0 时仅返回属于 Shards 中分片的事务
+	TotalShards int
+	// 需要查询的分片编号
+	Shards []int
+	// 分页游标, 为空时从第一页开始查询, 否则取值为上一页 GetHangingTXs 返回的 next
+	Cursor string
+	// 单页返回的事务数量上限, 为 0 时不限制
+	Limit int
+}
+
+// Match 判断事务是否满足查询条件, 便于 TXStore 的实现在内存中过滤
+func (q HangingQuery) Match(txID string) bool {
+	if q.TotalShards <= 0 {
+		return true
+	}
+	shard := ShardOf(txID, q.TotalShards)
+	for _, s := range q.Shards {
+		if s == shard {
+			return true
+		}
+	}
+	return false
+}
+
+// ShardCoordinator 分片恢复模式的协调模块, 负责节点的成员管理以及各分片的选主
+type ShardCoordinator interface {
+	// Heartbeat 上报节点存活, 超过 ttl 没有再次上报的节点视为已经离开
+	Heartbeat(ctx context.Context, nodeID string, ttl time.Duration) error
+	// Leave 节点主动离开
+	Leave(ctx context.Context, nodeID string) error
+	// Members 返回所有存活的节点
+	Members(ctx context.Context) ([]string, error)
+	// Elector 返回分片的选主模块, 所有节点针对同一分片返回的 Elector 需要基于同一份存储
+	Elector(shard int) Elector
+}
+
+// MemShardCoordinator 基于内存实现的分片协调模块, 适用于单测以及单进程内的多个 TXManager 共享
+type MemShardCoordinator struct {
+	mux      sync.Mutex
+	members  map[string]time.Time
+	electors map[int]*MemElector
+}
+
+// NewMemShardCoordinator 构造基于内存实现的分片协调模块
+func NewMemShardCoordinator() *MemShardCoordinator {
+	return &MemShardCoordinator{
+		members:  make(map[string]time.Time),
+		electors: make(map[int]*MemElector),
+	}
+}
+
+func (m *MemShardCoordinator) Heartbeat(ctx context.Context, nodeID string, ttl time.Duration) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.members[nodeID] = time.Now().Add(ttl)
+	return nil
+}
+
+func (m *MemShardCoordinator) Leave(ctx context.Context, nodeID string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	delete(m.members, nodeID)
+	return nil
+}
+
+func (m *MemShardCoordinator) Members(ctx context.Context) ([]string, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	now := time.Now()
+	members := make([]string, 0, len(m.members))
+	for nodeID, expireAt := range m.members {
+		if !now.Before(expireAt) {
+			delete(m.members, nodeID)
+			continue
+		}
+		members = append(members, nodeID)
+	}
+	return members, nil
+}
+
+func (m *MemShardCoordinator) Elector(shard int) Elector {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	elector, ok := m.electors[shard]
+	if !ok {
+		elector = NewMemElector()
+		m.electors[shard] = elector
+	}
+	return elector
+}
+
+// ownerOf 基于最高随机权重计算分片期望的归属节点, 所有节点基于相同的成员列表计算出的结果一致
+func ownerOf(members []string, shard int) string {
+	var (
+		owner string
+		max   uint64
+	)
+	for _, member := range members {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(member + "/" + strconv.Itoa(shard)))
+		if weight := mix64(h.Sum64()); owner == "" || weight > max || (weight == max && member < owner) {
+			owner, max = member, weight
+		}
+	}
+	return owner
+}
+
+// mix64 murmur3 的 fmix64, fnv 对于仅末尾不同的短字符串散列不够均匀, 需要进一步打散
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// defaultNodeID 未设置节点 id 时, 以主机名、进程号以及启动时间标识节点
+func defaultNodeID() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano())
+}
+
+// shardLeader 本节点持有租约的分片的轮询任务
+type shardLeader struct {
+	// 主动放弃分片
+	release context.CancelFunc
+	// 轮询任务退出(主动放弃或者租约丢失)后关闭
+	done chan struct{}
+}
+
+// runShards 分片恢复模式的异步轮询任务
+func (t *TXManager) runShards() {
+	leaders := make(map[int]*shardLeader)
+	defer func() {
+		// TXManager 停止时, 等待所有分片的轮询任务放弃租约后再离开
+		for _, leader := range leaders {
+			<-leader.done
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = t.opts.ShardCoordinator.Leave(ctx, t.opts.NodeID)
+	}()
+
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-time.After(t.opts.MonitorTick):
+			t.rebalance(leaders)
+		}
+	}
+}
+
+// rebalance 上报存活并调整本节点持有的分片
+//  1. 清理租约已经丢失的分片
+//  2. 主动放弃不再归属于本节点的分片
+//  3. 竞争归属于本节点但尚未持有的分片, 原归属节点尚未放弃时竞争失败, 下一轮重试
+func (t *TXManager) rebalance(leaders map[int]*shardLeader) {
+	t.opts.Metrics.RecoveryTick()
+	if err := t.opts.ShardCoordinator.Heartbeat(t.ctx, t.opts.NodeID, t.opts.LeaseTTL); err != nil {
+		t.logger(t.ctx).Warnw("shard heartbeat failed", "nodeID", t.opts.NodeID, "err", err)
+		return
+	}
+	members, err := t.opts.ShardCoordinator.Members(t.ctx)
+	if err != nil {
+		t.logger(t.ctx).Warnw("get shard members failed", "nodeID", t.opts.NodeID, "err", err)
+		return
+	}
+
+	for shard := 0; shard < t.opts.Shards; shard++ {
+		leader, ok := leaders[shard]
+		if ok {
+			select {
+			case <-leader.done:
+				delete(leaders, shard)
+				ok = false
+			default:
+			}
+		}
+
+		mine := ownerOf(members, shard) == t.opts.NodeID
+		if ok && !mine {
+			leader.release()
+			<-leader.done
+			delete(leaders, shard)
+			continue
+		}
+		if ok || !mine {
+			continue
+		}
+
+		elector := t.opts.ShardCoordinator.Elector(shard)
+		lease, err := elector.Acquire(t.ctx, t.opts.LeaseTTL)
+		if err != nil {
+			t.opts.Metrics.RecoveryLockFailed()
+			continue
+		}
+		ctx, release := context.WithCancel(log.WithFields(t.ctx, "shard", shard))
+		leader = &shardLeader{release: release, done: make(chan struct{})}
+		leaders[shard] = leader
+		go func(shard int) {
+			defer close(leader.done)
+			defer release()
+			t.lead(ctx, elector, lease, HangingQuery{TotalShards: t.opts.Shards, Shards: []int{shard}})
+		}(shard)
+	}
+}
@@ -0,0 +1,130 @@
+package txmanager
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+func Test_ShardOf(t *testing.T) {
+	if shard := ShardOf("1", 0); shard != 0 {
+		t.Errorf("shard: %d, want: 0", shard)
+	}
+	counts := make(map[int]int)
+	for i := 0; i < 1000; i++ {
+		shard := ShardOf(time.Duration(i).String(), 8)
+		if shard < 0 || shard >= 8 {
+			t.Fatalf("shard: %d out of range", shard)
+		}
+		counts[shard]++
+	}
+	if len(counts) != 8 {
+		t.Errorf("shards used: %d, want: 8", len(counts))
+	}
+
+	query := HangingQuery{TotalShards: 8, Shards: []int{ShardOf("42", 8)}}
+	if !query.Match("42") {
+		t.Error("tx in queried shard not matched")
+	}
+	if !(HangingQuery{}).Match("42") {
+		t.Error("empty query should match all txs")
+	}
+}
+
+// shardComponent 记录每笔事务由哪个节点执行 confirm
+type shardComponent struct {
+	mockComponent
+	node      string
+	confirmed *sync.Map
+}
+
+func (s *shardComponent) Confirm(ctx context.Context, txID string) (*component.TCCResp, error) {
+	s.confirmed.Store(txID, s.node)
+	return s.mockComponent.Confirm(ctx, txID)
+}
+
+// Test_ShardRebalance 各节点只推进归属于自己的分片中的事务, 节点加入和离开时分片重新分配
+func Test_ShardRebalance(t *testing.T) {
+	const shards = 8
+	txStore, coordinator := NewMemTXStore(), NewMemShardCoordinator()
+	confirmed := &sync.Map{}
+	newNode := func(node string) *TXManager {
+		txManager := NewTXManager(txStore, WithMonitorTick(10*time.Millisecond), WithLeaseTTL(90*time.Millisecond),
+			WithShards(shards, coordinator), WithNodeID(node), WithLogger(log.NewNopLogger()))
+		if err := txManager.Register(&shardComponent{mockComponent: mockComponent{id: "component", ack: true}, node: node, confirmed: confirmed}); err != nil {
+			t.Fatal(err)
+		}
+		return txManager
+	}
+	// createTXs 创建 n 笔 try 成功的 hanging 事务, 等待异步轮询流程推进完成后返回各事务的推进节点
+	createTXs := func(n int) map[string]string {
+		ctx := context.Background()
+		txIDs := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			txID, err := txStore.CreateTX(ctx, NewTransaction(ComponentEntities{{Component: &mockComponent{id: "component"}}}, time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = txStore.TXUpdate(ctx, txID, "component", true); err != nil {
+				t.Fatal(err)
+			}
+			txIDs = append(txIDs, txID)
+		}
+
+		nodes := make(map[string]string, n)
+		for deadline := time.Now().Add(2 * time.Second); len(nodes) < n && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			for _, txID := range txIDs {
+				if tx, _ := txStore.GetTX(ctx, txID); tx != nil && tx.Status == TXSuccessful {
+					node, _ := confirmed.Load(txID)
+					nodes[txID], _ = node.(string)
+				}
+			}
+		}
+		if len(nodes) < n {
+			t.Fatalf("finalized txs: %d, want: %d", len(nodes), n)
+		}
+		return nodes
+	}
+	// 等待分片调整完成
+	settle := func() {
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	// 1. 单个节点持有全部分片
+	a := newNode("a")
+	defer a.Stop()
+	settle()
+	for txID, node := range createTXs(16) {
+		if node != "a" {
+			t.Errorf("tx: %s advanced by: %s, want: a", txID, node)
+		}
+	}
+
+	// 2. 节点加入后, 各事务由其分片期望的归属节点推进
+	b := newNode("b")
+	settle()
+	members := []string{"a", "b"}
+	used := make(map[string]bool)
+	for txID, node := range createTXs(16) {
+		if want := ownerOf(members, ShardOf(txID, shards)); node != want {
+			t.Errorf("tx: %s advanced by: %s, want: %s", txID, node, want)
+		}
+		used[node] = true
+	}
+	if len(used) != 2 {
+		t.Errorf("nodes used: %v, want both", used)
+	}
+
+	// 3. 节点离开后, 剩余节点接管全部分片
+	b.Stop()
+	settle()
+	for txID, node := range createTXs(16) {
+		if node != "a" {
+			t.Errorf("tx: %s advanced by: %s, want: a", txID, node)
+		}
+	}
+}
@@ -11,35 +11,97 @@ import (
 // 1. 通过map存储所有注册进来的 TCC 组件ID和实际的 TCC 组件的映射！
 // 2. 通过读写锁 rwMutex 保护map的并发安全性
 // 3. 提供注册和查询 TCC 组件的功能
+// 4. Saga 组件同样注册在注册中心中, 组件 ID 在 TCC 组件和 Saga 组件之间同样不可重复
+// 5. 同时保存各组件的调用配置 ComponentOptions
 
 type registryCenter struct {
-	mux        sync.RWMutex
-	components map[string]component.TCCComponent
+	mux            sync.RWMutex
+	components     map[string]component.TCCComponent
+	sagaComponents map[string]component.SagaComponent
+	options        map[string]*ComponentOptions
 }
 
 // newRegistryCenter 构造 TXManager 的注册中心结构体
 func newRegistryCenter() *registryCenter {
 	return &registryCenter{
 		//mux: new(sync.RWMutex)
-		components: make(map[string]component.TCCComponent),
+		components:     make(map[string]component.TCCComponent),
+		sagaComponents: make(map[string]component.SagaComponent),
+		options:        make(map[string]*ComponentOptions),
 	}
 }
 
 // register 将 TCC 组件注册进入注册中心的map中, 存储 TCC 组件ID和 TCC 组件之间的映射关系
 // 提供接口给 TCC 组件注册时进行调用, 实现 TCC 组件自己注册进入 TX Manager 事务协调器的目的
-func (r *registryCenter) register(component component.TCCComponent) error {
+func (r *registryCenter) register(component component.TCCComponent, opts *ComponentOptions) error {
 	// 1. 通过 rwMutex 维护 map 的并发安全性
 	r.mux.Lock()
 	defer r.mux.Unlock()
 	// 2. 不能有重复的TCC 组件ID
-	if _, ok := r.components[component.ID()]; ok {
+	if r.existed(component.ID()) {
 		return errors.New("repeat component id")
 	}
 	// 3. 保存
 	r.components[component.ID()] = component
+	r.options[component.ID()] = opts
 	return nil
 }
 
+// registerSaga 将 Saga 组件注册进入注册中心
+func (r *registryCenter) registerSaga(component component.SagaComponent, opts *ComponentOptions) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.existed(component.ID()) {
+		return errors.New("repeat component id")
+	}
+	r.sagaComponents[component.ID()] = component
+	r.options[component.ID()] = opts
+	return nil
+}
+
+// getOptions 获取组件的调用配置, 组件未注册时返回不重试、不限制超时的配置
+func (r *registryCenter) getOptions(componentID string) *ComponentOptions {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	if opts, ok := r.options[componentID]; ok {
+		return opts
+	}
+	return &ComponentOptions{MaxAttempts: 1}
+}
+
+// existed 判断组件 ID 是否已经被注册, 调用方需要持有锁
+func (r *registryCenter) existed(componentID string) bool {
+	if _, ok := r.components[componentID]; ok {
+		return true
+	}
+	_, ok := r.sagaComponents[componentID]
+	return ok
+}
+
+// getMode 根据组件 ID 推断事务的执行模式, 同一笔事务中不允许混用 TCC 组件和 Saga 组件
+func (r *registryCenter) getMode(componentIDs ...string) (TXMode, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	var mode TXMode
+	for _, componentID := range componentIDs {
+		var cur TXMode
+		if _, ok := r.components[componentID]; ok {
+			cur = TXModeTCC
+		} else if _, ok = r.sagaComponents[componentID]; ok {
+			cur = TXModeSaga
+		} else {
+			return "", fmt.Errorf("component id: %s not existed", componentID)
+		}
+		if mode != "" && mode != cur {
+			return "", errors.New("tcc and saga components can not be mixed in one transaction")
+		}
+		mode = cur
+	}
+
+	return mode, nil
+}
+
 // getComponents 上游 TX Manager 通过事务ID获得对应的多个TCC组件实例!
 // 同样是暴露接口给上游调用
 func (r *registryCenter) getComponents(componentIDs ...string) ([]component.TCCComponent, error) {
@@ -58,3 +120,21 @@ func (r *registryCenter) getComponents(componentIDs ...string) ([]component.TCCC
 
 	return components, nil
 }
+
+// getSagaComponents 通过组件 ID 获得对应的多个 Saga 组件实例
+func (r *registryCenter) getSagaComponents(componentIDs ...string) ([]component.SagaComponent, error) {
+	components := make([]component.SagaComponent, 0, len(componentIDs))
+
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	for _, componentID := range componentIDs {
+		component, ok := r.sagaComponents[componentID]
+		if !ok {
+			return nil, fmt.Errorf("saga component id: %s not existed", componentID)
+		}
+		components = append(components, component)
+	}
+
+	return components, nil
+}
@@ -0,0 +1,115 @@
+package txmanager
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 链路追踪
+// 1. 基于 OpenTelemetry API 实现, 默认使用 otel 全局的 TracerProvider 以及 TextMapPropagator, 也可以通过 WithTracerProvider、WithPropagator 注入
+// 2. span 的组织方式:
+//  2.1 每笔事务的第一阶段对应一个根 span(gotcc.transaction), 携带事务 id 以及执行模式
+//  2.2 每次组件调用(包含重试)对应一个子 span(gotcc.component.try/confirm/cancel), 携带事务 id、组件 id 以及所处阶段
+//  2.3 异步轮询流程以及运维接口推进事务时创建 gotcc.recovery span, 父 span 为事务日志中持久化的事务根 span(未持久化时为新的根 span)
+//      调用方 ctx 中的 span(例如运维接口的请求链路)仅通过 link 关联, 不会成为父 span
+//  2.4 同步执行第二阶段时, 第二阶段对应事务根 span 的子 span(gotcc.second_phase)
+// 3. trace 上下文的传递:
+//  3.1 组件调用时 trace 上下文通过 Propagator 注入到 TCCReq.Metadata 中, 远程组件可以从中提取并延续链路
+//      Confirm、Cancel 只接收事务 id, 同样的 Metadata 通过 component.WithMetadata 注入 ctx, 组件通过 component.MetadataFromContext 获取
+//  3.2 事务根 span 的上下文以 W3C traceparent 的格式随事务日志持久化, 与 Propagator 的配置无关, 保证任意节点推进事务时都能回到原始链路
+
+const tracerName = "github.com/xiaoxuxiansheng/gotcc/txmanager"
+
+const (
+	attrTXID        = attribute.Key("gotcc.tx.id")
+	attrTXMode      = attribute.Key("gotcc.tx.mode")
+	attrTXStatus    = attribute.Key("gotcc.tx.status")
+	attrComponentID = attribute.Key("gotcc.component.id")
+	attrPhase       = attribute.Key("gotcc.phase")
+	attrAttempt     = attribute.Key("gotcc.attempt")
+	attrACK         = attribute.Key("gotcc.ack")
+)
+
+// tracer 返回 TXManager 使用的 tracer
+func (t *TXManager) tracer() trace.Tracer {
+	return t.opts.TracerProvider.Tracer(tracerName)
+}
+
+// startTXSpan 创建事务第一阶段的根 span
+func (t *TXManager) startTXSpan(ctx context.Context, mode TXMode) (context.Context, trace.Span) {
+	return t.tracer().Start(ctx, "gotcc.transaction",
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrTXMode.String(mode.String())),
+	)
+}
+
+// startRecoverySpan 创建推进事务的 span, 父 span 只取决于事务日志中持久化的原始链路, ctx 中已有的 span 通过 link 关联
+// 同步执行第二阶段时 ctx 中携带的即为事务的根 span, 此时创建其子 span
+func (t *TXManager) startRecoverySpan(ctx context.Context, tx *Transaction) (context.Context, trace.Span) {
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrTXID.String(tx.TXID), attrTXMode.String(tx.Mode.String())),
+	}
+
+	parent, ambient := spanContextOf(tx.TraceParent), trace.SpanContextFromContext(ctx)
+	if parent.IsValid() && ambient.TraceID() == parent.TraceID() && ambient.SpanID() == parent.SpanID() {
+		return t.tracer().Start(ctx, "gotcc.second_phase", opts...)
+	}
+
+	if parent.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, parent)
+	} else {
+		opts = append(opts, trace.WithNewRoot())
+	}
+	if ambient.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: ambient}))
+	}
+	return t.tracer().Start(ctx, "gotcc.recovery", opts...)
+}
+
+// startComponentSpan 创建组件调用的子 span
+func (t *TXManager) startComponentSpan(ctx context.Context, txID, componentID string, phase Phase) (context.Context, trace.Span) {
+	return t.tracer().Start(ctx, "gotcc.component."+phase.String(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrTXID.String(txID), attrComponentID.String(componentID), attrPhase.String(phase.String())),
+	)
+}
+
+// metadata 将 ctx 中的 trace 上下文注入到 TCCReq.Metadata 中, 没有需要传递的内容时返回 nil
+func (t *TXManager) metadata(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	t.opts.Propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// traceParentOf 以 W3C traceparent 的格式返回 ctx 中的 span 上下文, 用于随事务日志持久化
+func traceParentOf(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// spanContextOf 解析事务日志中持久化的 traceparent
+func spanContextOf(traceParent string) trace.SpanContext {
+	if traceParent == "" {
+		return trace.SpanContext{}
+	}
+	ctx := propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier{"traceparent": traceParent})
+	return trace.SpanContextFromContext(ctx)
+}
+
+// endSpan 记录错误并结束 span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,175 @@
+package txmanager
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+	"github.com/xiaoxuxiansheng/gotcc/log"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// metadataComponent 记录 try 请求以及 confirm 的 ctx 中携带的元数据
+type metadataComponent struct {
+	mockComponent
+	mux             sync.Mutex
+	metadata        map[string]string
+	confirmMetadata map[string]string
+}
+
+func (m *metadataComponent) Try(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+	m.mux.Lock()
+	m.metadata = req.Metadata
+	m.mux.Unlock()
+	return m.mockComponent.Try(ctx, req)
+}
+
+func (m *metadataComponent) Confirm(ctx context.Context, txID string) (*component.TCCResp, error) {
+	m.mux.Lock()
+	m.confirmMetadata = component.MetadataFromContext(ctx)
+	m.mux.Unlock()
+	return m.mockComponent.Confirm(ctx, txID)
+}
+
+// waitSpan 等待异步流程结束指定名称的 span
+func waitSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		for _, span := range recorder.Ended() {
+			if span.Name() == name {
+				return span
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("span: %s not ended", name)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func attributeOf(span sdktrace.ReadOnlySpan, key string) string {
+	for _, attr := range span.Attributes() {
+		if string(attr.Key) == key {
+			return attr.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func Test_Trace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	txManager := NewTXManager(NewMemTXStore(), WithMonitorTick(time.Hour), WithLogger(log.NewNopLogger()),
+		WithTracerProvider(provider), WithPropagator(propagation.TraceContext{}))
+	defer txManager.Stop()
+
+	c := &metadataComponent{mockComponent: mockComponent{id: "traced", ack: true}}
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	result, err := txManager.Execute(context.Background(), &RequestEntity{ComponentID: c.ID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1. 事务根 span 以及 try 子 span 均携带事务 id
+	root := waitSpan(t, recorder, "gotcc.transaction")
+	if got := attributeOf(root, "gotcc.tx.id"); got != result.TXID {
+		t.Errorf("root span tx id: %s, want: %s", got, result.TXID)
+	}
+	try := waitSpan(t, recorder, "gotcc.component.try")
+	if try.Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Errorf("try span parent: %s, want: %s", try.Parent().SpanID(), root.SpanContext().SpanID())
+	}
+	for key, want := range map[string]string{"gotcc.tx.id": result.TXID, "gotcc.component.id": c.ID(), "gotcc.phase": PhaseTry.String()} {
+		if got := attributeOf(try, key); got != want {
+			t.Errorf("try span attribute: %s, got: %s, want: %s", key, got, want)
+		}
+	}
+
+	// 2. trace 上下文通过 TCCReq.Metadata 传递给组件
+	c.mux.Lock()
+	metadata := c.metadata
+	c.mux.Unlock()
+	remote := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier(metadata)))
+	if remote.TraceID() != root.SpanContext().TraceID() || remote.SpanID() != try.SpanContext().SpanID() {
+		t.Errorf("metadata: %v, want trace: %s, span: %s", metadata, root.SpanContext().TraceID(), try.SpanContext().SpanID())
+	}
+
+	// 3. 异步推进 confirm 的 span 以原始链路的根 span 为父 span
+	recovery := waitSpan(t, recorder, "gotcc.recovery")
+	if recovery.Parent().SpanID() != root.SpanContext().SpanID() || len(recovery.Links()) != 0 {
+		t.Errorf("recovery span parent: %s, links: %v, want: %s", recovery.Parent().SpanID(), recovery.Links(), root.SpanContext().SpanID())
+	}
+	confirm := waitSpan(t, recorder, "gotcc.component.confirm")
+	if confirm.Parent().SpanID() != recovery.SpanContext().SpanID() {
+		t.Errorf("confirm span parent: %s, want: %s", confirm.Parent().SpanID(), recovery.SpanContext().SpanID())
+	}
+
+	// 4. confirm 只接收事务 id, trace 上下文通过 ctx 中的元数据传递给组件
+	c.mux.Lock()
+	metadata = c.confirmMetadata
+	c.mux.Unlock()
+	remote = trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier(metadata)))
+	if remote.TraceID() != root.SpanContext().TraceID() || remote.SpanID() != confirm.SpanContext().SpanID() {
+		t.Errorf("confirm metadata: %v, want trace: %s, span: %s", metadata, root.SpanContext().TraceID(), confirm.SpanContext().SpanID())
+	}
+}
+
+// Test_TraceRecoveryParent 推进事务的 span 只以持久化的原始链路为父 span, 调用方 ctx 中的 span 仅通过 link 关联
+func Test_TraceRecoveryParent(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	txStore := NewMemTXStore()
+	txManager := NewTXManager(txStore, WithMonitorTick(time.Hour), WithLogger(log.NewNopLogger()), WithTracerProvider(provider))
+	defer txManager.Stop()
+
+	c := &mockComponent{id: "traced", ack: true}
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1. 同步执行第二阶段时为事务根 span 的子 span
+	_, err := txManager.ExecuteWithOptions(context.Background(), []*RequestEntity{{ComponentID: c.ID()}}, WithTXSecondPhase(SecondPhaseSync))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := waitSpan(t, recorder, "gotcc.transaction")
+	if secondPhase := waitSpan(t, recorder, "gotcc.second_phase"); secondPhase.Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Errorf("second phase span parent: %s, want: %s", secondPhase.Parent().SpanID(), root.SpanContext().SpanID())
+	}
+
+	// 2. 运维接口等调用方携带自身的链路推进事务时, 父 span 仍为事务根 span, 调用方的 span 通过 link 关联
+	ctx := context.Background()
+	tx := NewTransaction(ComponentEntities{{Component: c}}, time.Hour)
+	txCtx, txSpan := provider.Tracer("test").Start(ctx, "origin")
+	tx.TraceParent = traceParentOf(txCtx)
+	txSpan.End()
+	txID, err := txStore.CreateTX(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = txStore.TXUpdate(ctx, txID, c.ID(), true); err != nil {
+		t.Fatal(err)
+	}
+
+	opCtx, opSpan := provider.Tracer("test").Start(ctx, "operator")
+	if err = txManager.advanceProgressByTXID(opCtx, txID); err != nil {
+		t.Fatal(err)
+	}
+	opSpan.End()
+
+	recovery := waitSpan(t, recorder, "gotcc.recovery")
+	if recovery.Parent().SpanID() != txSpan.SpanContext().SpanID() || recovery.SpanContext().TraceID() != txSpan.SpanContext().TraceID() {
+		t.Errorf("recovery span parent: %s, want: %s", recovery.Parent().SpanID(), txSpan.SpanContext().SpanID())
+	}
+	if links := recovery.Links(); len(links) != 1 || links[0].SpanContext.SpanID() != opSpan.SpanContext().SpanID() {
+		t.Errorf("recovery span links: %v, want: %s", links, opSpan.SpanContext().SpanID())
+	}
+}
@@ -9,6 +9,8 @@ import (
 
 	"github.com/xiaoxuxiansheng/gotcc/component"
 	"github.com/xiaoxuxiansheng/gotcc/log"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // TCC Manager 事务协调器  -> 封装成SDK(一组适合于开发人员的平台特定构建工具集)
@@ -30,6 +32,8 @@ type TXManager struct {
 	opts           *Options           // 内聚了一些 TXManager 的配置项，可以由使用方自定义，并通过 option 注入
 	txStore        TXStore            // 内置的事务日志存储模块，需要由使用方实现并完成注入
 	registryCenter *registryCenter    // TCC 组件的注册管理中心
+	events         chan *Event        // 事务生命周期事件的缓冲队列，由独立的 goroutine 分发给监听器
+	waiters        *waiters           // 等待事务最终状态提交的事务句柄
 }
 
 // NewTXManager 初始化并返回事务协调器 - 构造器方法
@@ -39,6 +43,7 @@ func NewTXManager(txStore TXStore, opts ...Option) *TXManager {
 		opts:           &Options{},
 		txStore:        txStore,
 		registryCenter: newRegistryCenter(),
+		waiters:        newWaiters(),
 		ctx:            ctx,
 		stop:           cancel,
 	}
@@ -49,6 +54,16 @@ func NewTXManager(txStore TXStore, opts ...Option) *TXManager {
 	}
 
 	repair(txManager.opts)
+	// 未注入选主模块时基于 TXStore.Lock 选主
+	if txManager.opts.Elector == nil {
+		txManager.opts.Elector = &txStoreElector{txStore: txStore}
+	}
+
+	// 注册了监听器时启动事件分发任务
+	if len(txManager.opts.Listeners) > 0 {
+		txManager.events = make(chan *Event, txManager.opts.ListenerBuffer)
+		go txManager.dispatch()
+	}
 
 	// 在TxManager实例被构造出来就会伴生地启动异步轮询任务
 	go txManager.run()
@@ -59,30 +74,178 @@ func (t *TXManager) Stop() {
 	t.stop()
 }
 
-func (t *TXManager) Register(component component.TCCComponent) error {
-	return t.registryCenter.register(component)
+// Register 注册 TCC 组件, opts 为组件的调用配置, 会覆盖组件通过 ComponentOptionsProvider 声明的配置
+func (t *TXManager) Register(component component.TCCComponent, opts ...ComponentOption) error {
+	return t.registryCenter.register(component, newComponentOptions(component, t.opts, opts...))
+}
+
+// RegisterSaga 注册 Saga 组件, 仅由 Saga 组件组成的事务会以 Saga 模式执行
+func (t *TXManager) RegisterSaga(component component.SagaComponent, opts ...ComponentOption) error {
+	return t.registryCenter.registerSaga(component, newComponentOptions(component, t.opts, opts...))
 }
 
 // Transaction 用户启动分布式事务的入口
 // -> reqs ...*RequestEntity 在入参中声明本次事务涉及到的组件以及需要在 Try 流程中传递给对应组件的请求参数
+// 单笔事务需要指定配置项时使用 TransactionWithOptions
 func (t *TXManager) Transaction(ctx context.Context, reqs ...*RequestEntity) (bool, error) {
-	tctx, cancel := context.WithTimeout(ctx, t.opts.Timeout)
-	defer cancel()
+	return t.TransactionWithOptions(ctx, reqs)
+}
 
-	// 1. 根据入参获得当前事务的所有的 TCC 组件
-	componentEntities, err := t.getComponents(tctx, reqs...)
+// TransactionWithOptions 按照单笔事务的配置项启动分布式事务
+// -> opts ...TXOption 单笔事务的配置项, 例如通过 WithTXTimeout 设置事务的执行时长限制, 通过 WithTXSecondPhase 同步等待第二阶段完成
+// 同步执行第二阶段且第二阶段未能在截止时间之前完成时, 返回事务的成败以及 ErrNotFinalized
+// 第一阶段结束时事务的成败无法确定时返回 ErrUndecided, 事务最终可能成功也可能失败, 调用方需要通过事务日志确认
+func (t *TXManager) TransactionWithOptions(ctx context.Context, reqs []*RequestEntity, opts ...TXOption) (bool, error) {
+	result, err := t.ExecuteWithOptions(ctx, reqs, opts...)
 	if err != nil {
 		return false, err
 	}
+	// 事务的成败交由异步轮询流程决议, 不能告知调用方事务失败
+	if result.Status == TXHanging {
+		return false, fmt.Errorf("%w, tx: %s", ErrUndecided, result.TXID)
+	}
+	// 同步执行第二阶段时, 第二阶段未能完成需要告知调用方, 此时事务的成败已经确定, 第二阶段由轮询任务兜底
+	if result.FinalizeErr != nil {
+		return result.Successful(), fmt.Errorf("%w, err: %v", ErrNotFinalized, result.FinalizeErr)
+	}
+	return result.Successful(), nil
+}
+
+// Execute 启动分布式事务, 并返回事务 id、各组件第一阶段的执行结果以及事务状态
+// 与 Transaction 不同的是, 组件 Try 失败的原因会保留在 TXResult 中返回给调用方
+func (t *TXManager) Execute(ctx context.Context, reqs ...*RequestEntity) (*TXResult, error) {
+	return t.ExecuteWithOptions(ctx, reqs)
+}
 
-	// 2. 创建事务明细记录，并取得全局唯一的事务 id
-	txID, err := t.txStore.CreateTX(tctx, componentEntities.ToComponents()...)
+// ExecuteWithOptions 按照单笔事务的配置项启动分布式事务, 并返回事务的执行结果
+func (t *TXManager) ExecuteWithOptions(ctx context.Context, reqs []*RequestEntity, opts ...TXOption) (*TXResult, error) {
+	_, commit, err := t.prepare(ctx, reqs, opts...)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	return commit(ctx), nil
+}
+
+// prepare 创建事务明细记录, 返回全局唯一的事务 id 以及执行事务第一阶段的函数
+// 第一阶段可以由调用方同步执行(Execute), 也可以异步执行(Submit)
+func (t *TXManager) prepare(ctx context.Context, reqs []*RequestEntity, opts ...TXOption) (string, func(ctx context.Context) *TXResult, error) {
+	txOpts := TXOptions{}
+	for _, opt := range opts {
+		opt(&txOpts)
 	}
+	repairTXOptions(&txOpts, t.opts)
 
-	// 3. 针对当前事务进行两阶段提交， try-confirm/cancel
-	return t.twoPhaseCommit(ctx, txID, componentEntities)
+	// 1. 根据入参获得当前事务的所有的 TCC 组件
+	componentEntities, err := t.getComponents(ctx, reqs...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// 2. 创建事务明细记录(连同各组件的 Try 请求参数、事务的截止时间以及根 span 的上下文一并持久化)，并取得全局唯一的事务 id
+	tx := NewTransaction(componentEntities, txOpts.Timeout)
+	// 创建事务的节点持有事务第一阶段的所有权租约, 租约到期之前异步轮询流程不会补发 Try
+	tx.OwnerExpireAt = tx.CreatedAt.Add(t.opts.OwnerTTL)
+	ctx, span := t.startTXSpan(ctx, tx.Mode)
+	tx.TraceParent = traceParentOf(ctx)
+	// 第一阶段需要在事务的截止时间之前完成
+	tctx, cancel := context.WithDeadline(ctx, tx.Deadline)
+	defer cancel()
+	txID, err := t.txStore.CreateTX(tctx, tx)
+	if err != nil {
+		endSpan(span, err)
+		return "", nil, err
+	}
+	span.SetAttributes(attrTXID.String(txID))
+	// 事务 id 会附加在后续的每一行日志中, 并随 ctx 传递给各个组件
+	tctx = log.WithFields(tctx, log.KeyTXID, txID)
+	t.opts.Metrics.TXStarted(tx.Mode)
+	t.emit(tctx, &Event{Type: EventTXCreated, TXID: txID, Mode: tx.Mode, Components: tx.Components})
+
+	commit := func(ctx context.Context) *TXResult {
+		defer span.End()
+		ctx, cancel := context.WithDeadline(trace.ContextWithSpan(ctx, span), tx.Deadline)
+		defer cancel()
+		tctx := log.WithFields(ctx, log.KeyTXID, txID)
+
+		// 第一阶段执行期间持续续约事务的所有权租约
+		octx, release := t.keepOwner(tctx, txID, tx.OwnerExpireAt)
+		var result *TXResult
+		if tx.isSaga() {
+			// 3. Saga 模式下顺序执行各组件的正向操作
+			result = t.sagaCommit(octx, txID, componentEntities)
+		} else {
+			// 4. 针对当前事务进行两阶段提交， try-confirm/cancel
+			result = t.twoPhaseCommit(octx, txID, componentEntities)
+		}
+		release()
+
+		t.emit(tctx, &Event{Type: EventTXDecided, TXID: txID, Mode: tx.Mode, Status: result.Status})
+		span.SetAttributes(attrTXStatus.String(result.Status.String()))
+		if err := result.Err(); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		// 5. 根据事务ID推进当前事务执行第二阶段(Confirm或者Cancel)
+		// 默认异步执行，是因为实际上在第一阶段 try 的响应结果尘埃落定时，对应事务的成败已经有了定论
+		// 第二阶段能够容忍异步执行的原因在于，执行失败时，还有轮询任务进行兜底
+		if txOpts.SecondPhase != SecondPhaseSync {
+			go t.advanceProgressByTXID(t.ctx, txID)
+			return result
+		}
+		// 同步模式下第二阶段同样需要在截止时间之前完成, 超时或者失败时交由轮询任务兜底
+		if result.FinalizeErr = t.advanceProgressByTXID(ctx, txID); result.FinalizeErr != nil {
+			return result
+		}
+		// 推进流程正常返回时事务仍可能处于 hanging 状态(例如补发的 Try 结果未知), 以事务日志中的状态为准
+		stored, err := t.txStore.GetTX(ctx, txID)
+		if err != nil {
+			result.FinalizeErr = err
+			return result
+		}
+		if stored.Status != TXSuccessful && stored.Status != TXFailure {
+			result.FinalizeErr = fmt.Errorf("tx status: %s", stored.Status)
+			return result
+		}
+		result.Finalized = true
+		return result
+	}
+	return txID, commit, nil
+}
+
+// keepOwner 在第一阶段执行期间按照 OwnerTTL/3 的间隔续约事务的所有权租约, 返回执行第一阶段使用的 ctx 以及停止续约的函数
+// 续约失败时租约可能已经到期, 异步轮询流程随时可能补发 Try, 此时终止第一阶段, 事务的成败交由异步轮询流程决议
+func (t *TXManager) keepOwner(ctx context.Context, txID string, expireAt time.Time) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(t.opts.OwnerTTL / 3):
+			}
+
+			// 续约需要在租约到期之前完成
+			next := time.Now().Add(t.opts.OwnerTTL)
+			rctx, rcancel := context.WithDeadline(ctx, expireAt)
+			err := t.txStore.TXRenewOwner(rctx, txID, next)
+			rcancel()
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				t.logger(ctx).Warnw("tx owner lease lost, abort first phase", "err", err)
+				cancel()
+				return
+			}
+			expireAt = next
+		}
+	}()
+	return ctx, func() {
+		cancel()
+		<-done
+	}
 }
 
 // backOffTick 增加轮询时间间隔
@@ -98,16 +261,59 @@ func (t *TXManager) backOffTick(tick time.Duration) time.Duration {
 // run 异步轮询流程, 用于提高事务执行第二阶段的成功率.
 //  1. 作用: 倘若存在事务已经完成第一阶段 Try 操作的执行，但是第二阶段没执行成功，
 // 			  则需要由异步轮询流程进行兜底处理，为事务补齐第二阶段的操作，并将事务状态更新为终态
-//  2. 实现方式: for循环 + select 多路复用 + 分布式锁
+//  2. 实现方式: for循环 + select 多路复用 + 选主
 //	 2.1 select 多路复用保证当txManager事务协调器的ctx被关闭后能够及时的关闭异步轮询的goroutine
-//   2.2 对 txStore 加分布式锁，避免分布式服务下多个 TX Manager 服务实例的轮询任务重复执行
+//   2.2 通过 Elector 选主，只有持有租约的 leader 节点执行轮询任务，避免分布式服务下多个 TX Manager 服务实例的轮询任务重复执行
+//   2.3 leader 在后台续约，租约丢失时立即终止正在执行的推进流程并退位，重新参与选主
+//   2.4 分页获取 hanging 事务并通过有限数量的 worker 推进，避免大量积压的事务耗尽内存或者压垮组件
 func (t *TXManager) run() {
-	var tick time.Duration
-	var err error
+	// 开启分片恢复模式时, 各节点分别推进所持有分片中的事务
+	if t.opts.Shards > 0 {
+		t.runShards()
+		return
+	}
+
 	// for 循环自旋
 	for {
-		// 每一次循环都需要对 tick 重新赋值
-		// 如果出现了失败，tick 需要避让，遵循退避策略增大 tick 间隔时长
+		select {
+		// 当需要关闭的时候, 通过 t.ctx 传入关闭信息, 一旦收到关闭信息, 就会退出异步轮询任务
+		case <-t.ctx.Done():
+			return
+		// time.After(tick)将在tick秒后发送信号, 即每隔tick秒后执行一次case后代码
+		case <-time.After(t.opts.MonitorTick):
+			t.opts.Metrics.RecoveryTick()
+			lease, err := t.opts.Elector.Acquire(t.ctx, t.opts.LeaseTTL)
+			if err != nil {
+				// 取主失败时（大概率其他TX Manager 服务实例是 leader），等待下一次轮询再参与选主
+				t.opts.Metrics.RecoveryLockFailed()
+				continue
+			}
+			// 作为 leader 执行轮询任务, 直到租约丢失或者 TXManager 停止
+			t.lead(t.ctx, t.opts.Elector, lease, HangingQuery{})
+		}
+	}
+}
+
+// lead leader 节点的轮询任务, 推进满足 query 条件的 hanging 事务, 直到租约丢失或者 ctx 终止
+//  1. 推进流程使用的 ctx 携带租约的 fencing token, 并在租约丢失时终止
+//  2. 如果处理过程中出现了错误，tick 需要避让，遵循退避策略增大 tick 间隔时长
+func (t *TXManager) lead(ctx context.Context, elector Elector, lease *Lease, query HangingQuery) {
+	ctx, stepDown := context.WithCancel(WithFencingToken(ctx, lease.Token))
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		t.keepLease(ctx, stepDown, elector, lease)
+	}()
+	defer func() {
+		stepDown()
+		<-renewed
+	}()
+
+	// tick 从默认的轮询间隔开始退避, 避免获取事务持续失败时轮询任务空转
+	tick := t.opts.MonitorTick
+	for {
+		// 分页获取仍然处于 hanging 状态(中间状态)的事务并推进, 最早创建的事务最先推进
+		err := t.recoverHangingTXs(ctx, query)
 		if err == nil {
 			// 没有错误就赋值默认轮询监控任务间隔时长
 			tick = t.opts.MonitorTick
@@ -116,214 +322,445 @@ func (t *TXManager) run() {
 			tick = t.backOffTick(tick)
 		}
 		select {
-		// 当需要关闭的时候, 通过 t.ctx 传入关闭信息, 一旦收到关闭信息, 就会退出异步轮询任务
-		case <-t.ctx.Done():
+		// 租约丢失或者 TXManager 停止
+		case <-ctx.Done():
 			return
-		// time.After(tick)将在tick秒后发送信号, 即每隔tick秒后执行一次case后代码
 		case <-time.After(tick):
-			// 对 txStore 加分布式锁，避免分布式服务下多个 TX Manager 服务实例的轮询任务重复执行
-			if err = t.txStore.Lock(t.ctx, t.opts.MonitorTick); err != nil {
-				// 取锁失败时（大概率被其他TX Manager 服务实例占有），不对 tick 进行退避升级
-				err = nil
-				continue
-			}
+			t.opts.Metrics.RecoveryTick()
+		}
+	}
+}
 
-			// 获取仍然处于 hanging 状态(中间状态)的事务(注意这里是事务本身, 而不是事务ID)
-			var txs []*Transaction
-			// 所有的事务状态根据事务日志中记录的事务来获取
-			// 日志中的事务状态是上一次轮询推进过程中剩下的处于 hanging 状态的事务!
-			if txs, err = t.txStore.GetHangingTXs(t.ctx); err != nil {
-				// 获取出错的话, 就关闭锁等待下一次的异步调用
-				_ = t.txStore.Unlock(t.ctx)
-				continue
-			}
+// keepLease 按照 LeaseTTL/3 的间隔续约, 续约失败时通过 stepDown 终止 leader 的轮询任务
+// TXManager 停止或者分片不再归属于本节点时主动放弃 leader 身份, 便于其他节点尽快接管
+func (t *TXManager) keepLease(ctx context.Context, stepDown context.CancelFunc, elector Elector, lease *Lease) {
+	defer stepDown()
+	for {
+		select {
+		case <-ctx.Done():
+			rctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			_ = elector.Resign(rctx, lease)
+			cancel()
+			return
+		case <-time.After(t.opts.LeaseTTL / 3):
+		}
 
-			err = t.batchAdvanceProgress(txs)
-			_ = t.txStore.Unlock(t.ctx)
+		// 续约需要在租约过期之前完成
+		rctx, cancel := context.WithDeadline(ctx, lease.ExpireAt)
+		renewed, err := elector.Renew(rctx, lease, t.opts.LeaseTTL)
+		cancel()
+		if err != nil {
+			t.logger(ctx).Warnw("lease lost, step down", "token", lease.Token, "err", err)
+			return
 		}
+		lease = renewed
 	}
 }
 
-// batchAdvanceProgress 批量推进处于中间态的任务
-// 如果推进每个处于中间态的事务的过程中, 出现错误的话, 只会返回发生的第一个错误
-func (t *TXManager) batchAdvanceProgress(txs []*Transaction) error {
-	// 对每笔事务进行状态推进
-	errCh := make(chan error)
-	// 另起一个goroutine 推进所有处于中间态的事务
-	go func() {
-		// 并发执行，推进各比事务的进度
-		var wg sync.WaitGroup
-		for _, tx := range txs {
-			// shadow
-			tx := tx
-			wg.Add(1)
-			// 对于每笔事务都启动 goroutine 进行该事务下所有 TCC 组件的重试操作
-			go func() {
-				defer wg.Done()
-				if err := t.advanceProgress(tx); err != nil {
-					// 遇到错误则投递到 errCh
-					errCh <- err
-				}
-			}()
-		}
-		// 所有事务的推进操作结束才能继续执行
-		wg.Wait()
-		// 最后关闭 errCh 通道
-		close(errCh)
+// recoverHangingTXs 按照创建时间由早到晚分页推进所有满足 query 条件的 hanging 事务
+//  1. 单页事务推进完成后再获取下一页, 内存中最多保留一页事务
+//  2. 单笔事务推进失败时按照该事务自身的退避策略重试, 不影响其余事务以及轮询间隔, 只有获取事务失败时返回错误
+func (t *TXManager) recoverHangingTXs(ctx context.Context, query HangingQuery) error {
+	// 获取仍然处于 hanging 状态(中间状态)的事务(注意这里是事务本身, 而不是事务ID)
+	// 所有的事务状态根据事务日志中记录的事务来获取
+	// 日志中的事务状态是上一次轮询推进过程中剩下的处于 hanging 状态的事务!
+	query.Cursor, query.Limit = "", t.opts.RecoveryBatch
+	var count int
+	defer func() {
+		t.opts.Metrics.HangingTXs(count)
 	}()
+	for {
+		txs, next, err := t.txStore.GetHangingTXs(ctx, query)
+		if err != nil {
+			// 无法获取下一页, 本轮推进终止
+			return err
+		}
+		count += len(txs)
+		if err = t.batchAdvanceProgress(ctx, txs); err != nil {
+			t.logger(ctx).Warnw("advance hanging txs failed", "err", err)
+		}
+		if next == "" || ctx.Err() != nil {
+			return nil
+		}
+		query.Cursor = next
+	}
+}
 
-	var firstErr error
-	// 当 errCh 通道中没有错误的时候会发生阻塞
-	// 直到 errCh 通道关闭过后, 才会继续执行(退出for循环)
-	// 父 goroutine 通过 chan 阻塞在这里, 直到所有 goroutine 执行完成关闭 channel 通道才会继续执行
-	for err := range errCh {
-		// 记录遇到的第一个错误
-		if firstErr != nil {
+// batchAdvanceProgress 批量推进处于中间态的任务
+// 1. 由 RecoveryConcurrency 个 worker 并发推进, 按照 txs 的顺序依次领取事务, 尚未到达重试时间的事务本轮跳过
+// 2. 如果推进每个处于中间态的事务的过程中, 出现错误的话, 只会返回发生的第一个错误
+func (t *TXManager) batchAdvanceProgress(ctx context.Context, txs []*Transaction) error {
+	now := time.Now()
+	pending := make([]*Transaction, 0, len(txs))
+	for _, tx := range txs {
+		if tx.NextRetryAt.After(now) {
 			continue
 		}
-		firstErr = err
+		pending = append(pending, tx)
+	}
+	txs = pending
+
+	workers := t.opts.RecoveryConcurrency
+	if workers > len(txs) {
+		workers = len(txs)
 	}
 
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	queue := make(chan *Transaction)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		// 每个 worker 依次领取事务并推进该事务下所有 TCC 组件的重试操作
+		go func() {
+			defer wg.Done()
+			for tx := range queue {
+				if err := t.advanceProgress(ctx, tx); err != nil {
+					// 记录遇到的第一个错误
+					once.Do(func() {
+						firstErr = err
+					})
+				}
+			}
+		}()
+	}
+
+	// 按照顺序投递事务, ctx 终止后不再投递尚未开始推进的事务
+dispatch:
+	for _, tx := range txs {
+		select {
+		case queue <- tx:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(queue)
+	// 所有事务的推进操作结束才能继续执行
+	wg.Wait()
 	return firstErr
 }
 
 // advanceProgressByTXID 传入一个事务 id 推进其进度
-func (t *TXManager) advanceProgressByTXID(txID string) error {
+func (t *TXManager) advanceProgressByTXID(ctx context.Context, txID string) error {
 	// 根据 txID 事务ID从事务日志中获取该事务的日志记录
-	tx, err := t.txStore.GetTX(t.ctx, txID)
+	tx, err := t.txStore.GetTX(ctx, txID)
 	if err != nil {
 		return err
 	} //
-	return t.advanceProgress(tx)
+	return t.advanceProgress(ctx, tx)
 }
 
 // advanceProgress 传入一个事务推进其进度
 // 传入的事务是在上一次轮询调度的时候是 hanging 的状态, 这里需要判断这些事务是否有所更新
-func (t *TXManager) advanceProgress(tx *Transaction) error {
+// ctx 为异步推进时的 t.ctx、leader 轮询任务携带 fencing token 的 ctx、同步执行第二阶段时携带截止时间的 ctx, 或者运维接口调用方的 ctx
+func (t *TXManager) advanceProgress(ctx context.Context, tx *Transaction) (err error) {
 	// 1. 根据各个 component try 请求的情况，推断出事务当前的状态
 	// 				当前事务的 TCC 组件状态                       <->         当前事务状态
 	//              所有 TCC 组件Try操作都成功      TrySuccessful <->      成功       TXSuccessful
 	//    所有 TCC 组件Try操作有一个处于 hanging 状态 TryHanging    <->      hanging   TXHanging
 	//           所有 TCC 组件Try操作有一个失败       TryFailure   <->      失败       TXFailure
 
-	// time.Now().Add(-t.opts.Timeout) 当前时间减去事务最长执行时间 -> 当前事务最早创建的时间
-	txStatus := tx.getStatus(time.Now().Add(-t.opts.Timeout))
-	// 1.1 当前事务状态为 hanging (表示存在 TCC 组件状态为 hanging) 的暂时不处理 等待下一轮询推进的时候再处理
+	// 以事务日志中持久化的截止时间判断事务是否超时, 而非当前节点的 Timeout 配置
+	tx.repairDeadline(t.opts.Timeout)
+	txStatus := tx.getStatus(time.Now())
+	// 存在 try 结果未知的组件时, 事务的成败由异步轮询流程判定
+	decidedByRecovery := tx.hasHangingComponents()
+	// 运维人员强制决议后, 不再依据组件的 try 状态以及截止时间判定事务的成败
+	// 强制决议随事务日志持久化, 部分组件完成第二阶段后推进中断时, 后续的推进流程仍然遵循同一决议
+	if tx.ForcedStatus != "" {
+		txStatus, decidedByRecovery = tx.ForcedStatus, true
+	}
+	// 推进过程对应事务第一阶段根 span 的子 span, 调用方 ctx 中的 span 通过 link 关联
+	ctx, span := t.startRecoverySpan(log.WithFields(ctx, log.KeyTXID, tx.TXID), tx)
+	defer func() {
+		// 推进失败时累计失败次数, 达到上限后置为 dead_letter 状态
+		if err != nil {
+			t.recordFailure(ctx, tx, err)
+		}
+		endSpan(span, err)
+	}()
+	// 1.1 当前事务状态为 hanging (表示存在 TCC 组件状态为 hanging), 基于事务日志中持久化的请求参数重新发起 Try 请求
+	// 倘若重试过后仍存在 hanging 的组件，则暂时不处理 等待下一轮询推进的时候再处理
 	if txStatus == TXHanging {
-		return nil
+		if txStatus = t.retryHangingTries(ctx, tx); txStatus == TXHanging {
+			return nil
+		}
+	}
+	span.SetAttributes(attrTXStatus.String(txStatus.String()))
+	if decidedByRecovery {
+		t.emit(ctx, &Event{Type: EventTXDecided, TXID: tx.TXID, Mode: tx.Mode, Status: txStatus, Timeout: txStatus == TXFailure && tx.timedOut(time.Now())})
+	}
+
+	// 1.2 Saga 模式的事务没有 confirm 阶段, 失败时需要逆序执行补偿操作
+	if tx.isSaga() {
+		return t.advanceSagaProgress(ctx, tx, txStatus == TXSuccessful)
 	}
 
 	success := txStatus == TXSuccessful
-	var confirmOrCancel func(ctx context.Context, component component.TCCComponent) (*component.TCCResp, error)
+	phase, eventType := PhaseCancel, EventComponentCancelled
+	var confirmOrCancel func(ctx context.Context, component component.TCCComponent, req *component.TCCReq) (*component.TCCResp, error)
 	var txAdvanceProgress func(ctx context.Context) error
-	// 1.2 当前事务状态为 successful (表示所有 TCC 组件状态都是successful), 就需要推进 Confirm 操作
-	// 1.3 当前事务状态为 failure (表示所有 TCC 组件状态都是successful), 就需要推进 Cancel 操作
+	// 1.3 当前事务状态为 successful (表示所有 TCC 组件状态都是successful), 就需要推进 Confirm 操作
+	// 1.4 当前事务状态为 failure (表示所有 TCC 组件状态都是successful), 就需要推进 Cancel 操作
 	// 根据事务是否成功，定制不同的处理函数以供后续调用!
 	if success {
-		confirmOrCancel = func(ctx context.Context, component component.TCCComponent) (*component.TCCResp, error) {
+		phase, eventType = PhaseConfirm, EventComponentConfirmed
+		confirmOrCancel = func(ctx context.Context, component component.TCCComponent, req *component.TCCReq) (*component.TCCResp, error) {
 			// 对 component 进行第二阶段的 confirm 操作
-			return component.Confirm(ctx, tx.TXID)
+			return component.Confirm(ctx, req.TXID)
 		}
 		txAdvanceProgress = func(ctx context.Context) error {
 			// 更新事务日志记录的状态为成功
-			return t.txStore.TXSubmit(ctx, tx.TXID, true)
+			return t.submit(ctx, tx, true)
 		}
 
 	} else {
-		confirmOrCancel = func(ctx context.Context, component component.TCCComponent) (*component.TCCResp, error) {
+		confirmOrCancel = func(ctx context.Context, component component.TCCComponent, req *component.TCCReq) (*component.TCCResp, error) {
 			// 对 component 进行第二阶段的 cancel 操作
-			return component.Cancel(ctx, tx.TXID)
+			return component.Cancel(ctx, req.TXID)
 		}
 
 		txAdvanceProgress = func(ctx context.Context) error {
 			// 更新事务日志记录的状态为失败
-			return t.txStore.TXSubmit(ctx, tx.TXID, false)
+			return t.submit(ctx, tx, false)
 		}
 	}
 
-	// 2. 遍历该事务的所有 TCC 组件执行第二阶段的动作
-	for _, component := range tx.Components {
-		// 2.1 根据 TXManager 事务协调器中事务对应 TCC 组件ID 获取实际的对应的 TCC component
-		components, err := t.registryCenter.getComponents(component.ComponentID)
-		if err != nil || len(components) == 0 {
+	// 2. 按照组件间的依赖关系确定第二阶段的执行顺序: confirm 按照拓扑顺序执行, cancel 按照拓扑逆序执行
+	components, err := tx.sortedComponents()
+	if err != nil {
+		return err
+	}
+	if !success {
+		for i, j := 0, len(components)-1; i < j; i, j = i+1, j-1 {
+			components[i], components[j] = components[j], components[i]
+		}
+	}
+
+	// 3. 遍历该事务的所有 TCC 组件执行第二阶段的动作
+	for _, componentEntity := range components {
+		// 3.1 根据 TXManager 事务协调器中事务对应 TCC 组件ID 获取实际的对应的 TCC component
+		tccComponents, err := t.registryCenter.getComponents(componentEntity.ComponentID)
+		if err != nil || len(tccComponents) == 0 {
 			return errors.New("get tcc component failed")
 		}
-		// 2.2 执行二阶段的 confirm 或者 cancel 操作
-		resp, err := confirmOrCancel(t.ctx, components[0])
+		// 3.2 按照组件的调用配置执行二阶段的 confirm 或者 cancel 操作
+		req := &component.TCCReq{ComponentID: componentEntity.ComponentID, TXID: tx.TXID}
+		resp, err := t.invoke(ctx, phase, req, func(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+			return confirmOrCancel(ctx, tccComponents[0], req)
+		})
+		t.emit(ctx, &Event{Type: eventType, TXID: tx.TXID, Mode: tx.Mode, ComponentID: componentEntity.ComponentID, Phase: phase, ACK: acked(resp, err), Err: err})
 		if err != nil {
 			return err
 		}
 		if !resp.ACK {
-			return fmt.Errorf("component: %s ack failed", component.ComponentID)
+			return fmt.Errorf("component: %s ack failed", componentEntity.ComponentID)
 		}
 	}
 
-	// 3. 二阶段操作都执行完成后，对事务状态进行提交
-	return txAdvanceProgress(t.ctx)
+	// 4. 二阶段操作都执行完成后，对事务状态进行提交
+	return txAdvanceProgress(ctx)
 }
 
-func (t *TXManager) twoPhaseCommit(ctx context.Context, txID string, componentEntities ComponentEntities) (bool, error) {
+// retryHangingTries 针对事务中 try 状态仍为 hanging 的组件重新发起 Try 请求, 并返回重试后事务的状态
+// 1. 由于创建事务的 TX Manager 节点可能在 Try 阶段宕机, 因此任意节点都需要能够基于事务日志中的请求参数补发 Try
+// 2. 创建事务的节点的所有权租约到期之前, 其第一阶段可能仍在执行, 此时不能补发 Try, 否则补发的结果可能被据此决议,
+//    而原始的第一阶段基于自身的结果做出相反的决议. TXStore 同样拒绝覆盖已经写入的 try 结果
+func (t *TXManager) retryHangingTries(ctx context.Context, tx *Transaction) TXStatus {
+	// 1. 创建事务的节点仍持有所有权租约时等待下一轮推进, 租约到期之前事务超时的直接判定为失败
+	// Saga 模式下补发的正向操作同样不能与创建事务的节点仍在执行的正向操作并发
+	if !tx.abandoned(time.Now()) {
+		return TXHanging
+	}
+
+	// 2. 重试的 Try 请求同样需要在事务的截止时间之前完成
+	ctx, cancel := context.WithDeadline(ctx, tx.Deadline)
+	defer cancel()
+
+	// 3. 按照依赖关系的拓扑顺序补发 Try, 被依赖的组件 Try 成功后才能补发依赖方的 Try
+	sortedComponents, err := tx.sortedComponents()
+	if err != nil {
+		t.logger(ctx).Errorw("sort tx components failed", "err", err)
+		return TXHanging
+	}
+
+	// Saga 模式下需要按序补发正向操作
+	if tx.isSaga() {
+		t.retrySagaActions(ctx, tx.TXID, sortedComponents)
+		return tx.getStatus(time.Now())
+	}
+
+	idToComponent := make(map[string]*ComponentTryEntity, len(sortedComponents))
+	for _, componentEntity := range sortedComponents {
+		idToComponent[componentEntity.ComponentID] = componentEntity
+	}
+
+	for _, componentEntity := range sortedComponents {
+		if componentEntity.TryStatus != TryHanging || !dependenciesAccepted(idToComponent, componentEntity.DependsOn) {
+			continue
+		}
+
+		components, err := t.registryCenter.getComponents(componentEntity.ComponentID)
+		if err != nil || len(components) == 0 {
+			t.logger(ctx).Errorw("get tcc component failed", log.KeyComponentID, componentEntity.ComponentID, "err", err)
+			continue
+		}
+
+		// 4. 使用事务日志中持久化的请求参数重新执行 Try 操作
+		req := &component.TCCReq{ComponentID: componentEntity.ComponentID, TXID: tx.TXID, Data: componentEntity.Request}
+		resp, err := t.invoke(ctx, PhaseTry, req, components[0].Try)
+		t.emit(ctx, &Event{Type: EventComponentTried, TXID: tx.TXID, Mode: tx.Mode, ComponentID: componentEntity.ComponentID, Phase: PhaseTry, Request: componentEntity.Request, ACK: acked(resp, err), Err: err})
+		// 4.1 请求出错时无法判定 try 的结果, 保持 hanging 状态等待下一轮推进
+		if err != nil {
+			t.logger(ctx).Errorw("tx retry try failed", log.KeyComponentID, componentEntity.ComponentID, "err", err)
+			continue
+		}
+
+		// 5. 将 try 的响应结果更新到事务日志中
+		if err = t.txStore.TXUpdate(ctx, tx.TXID, componentEntity.ComponentID, resp.ACK); err != nil {
+			t.logger(ctx).Errorw("tx updated failed", log.KeyComponentID, componentEntity.ComponentID, "err", err)
+			continue
+		}
+		if resp.ACK {
+			componentEntity.TryStatus = TrySucceesful
+		} else {
+			componentEntity.TryStatus = TryFailure
+		}
+	}
+
+	return tx.getStatus(time.Now())
+}
+
+func (t *TXManager) twoPhaseCommit(ctx context.Context, txID string, componentEntities ComponentEntities) *TXResult {
 	// 1. 创建子 context 用于管理子 goroutine 生命周期
 	cctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	errCh := make(chan error)
+	result := newTXResult(txID, componentEntities)
+	// 各组件 try 的完成信号, 依赖方需要等待被依赖组件 try 成功后才能执行
+	nodes := newTryNodes(componentEntities)
 	// 2. 并发启动，批量执行各 tcc 组件的 try 流程
-	go func() {
-		var wg sync.WaitGroup
-		for _, componentEntity := range componentEntities {
-			// shadow
-			componentEntity := componentEntity
-			wg.Add(1)
-			// 2.1 针对当前组件需要另起一个协程来启动 Try 操作
-			go func() {
-				defer wg.Done()
-				// 2.2 当前组件执行 Try 操作
-				resp, err := componentEntity.Component.Try(cctx, &component.TCCReq{
-					ComponentID: componentEntity.Component.ID(),
-					TXID:        txID,
-					Data:        componentEntity.Request,
-				})
-				// 2.3 但凡有一个 component try 报错或者拒绝，那么整个事务都需要 cancel 的，但会放在 advanceProgressByTXID 流程处理
-				if err != nil || !resp.ACK {
-					log.ErrorContextf(cctx, "tx try failed, tx id: %s, comonent id: %s, err: %v", txID, componentEntity.Component.ID(), err)
-					// 2.3.1 对对应的事务进行更新
-					if _err := t.txStore.TXUpdate(cctx, txID, componentEntity.Component.ID(), false); _err != nil {
-						log.ErrorContextf(cctx, "tx updated failed, tx id: %s, component id: %s, err: %v", txID, componentEntity.Component.ID(), _err)
-					}
-					// 2.3.2 将当前错误传入通道, 而一旦for循环执行一次就会调用 cancel 方法熔断其他所有子 goroutine 流程!
-					errCh <- fmt.Errorf("component: %s try failed", componentEntity.Component.ID())
-					return
-				}
-				// 2.4 try 请求成功，但是请求结果更新到事务日志失败时，也需要视为处理失败
-				if err = t.txStore.TXUpdate(cctx, txID, componentEntity.Component.ID(), true); err != nil {
-					log.ErrorContextf(cctx, "tx updated failed, tx id: %s, component id: %s, err: %v", txID, componentEntity.Component.ID(), err)
-					errCh <- err
-				}
-			}()
+	// 每个 goroutine 只会写入属于当前组件的执行结果, 不依赖任何 channel 与父 goroutine 通信, 因此不会因为无人接收而阻塞
+	var wg sync.WaitGroup
+	for i, componentEntity := range componentEntities {
+		// shadow
+		componentEntity := componentEntity
+		componentResult := result.Components[i]
+		wg.Add(1)
+		// 2.1 针对当前组件需要另起一个协程来启动 Try 操作
+		go func() {
+			defer wg.Done()
+			node := nodes[componentEntity.ID()]
+			defer close(node.done)
+			// 2.2 但凡有一个 component try 报错或者拒绝，那么整个事务都需要 cancel 的，直接熔断其他所有子 goroutine 流程!
+			if !t.try(cctx, txID, componentEntity, nodes, componentResult) {
+				cancel()
+				return
+			}
+			// 2.3 try 成功, 放行依赖当前组件的其他组件
+			node.accepted = true
+		}()
+	}
+
+	// 3. 等待所有组件的 try 流程结束, 此时所有组件的执行结果都已经写入 result
+	wg.Wait()
+
+	result.Status = TXSuccessful
+	for _, componentResult := range result.Components {
+		if componentResult.TryStatus != TrySucceesful {
+			result.Status = TXFailure
+			break
 		}
+	}
 
-		wg.Wait()
-		// 关闭 errCh，告知父 goroutine 所有任务已运行完成的信息
-		close(errCh)
-	}()
+	// 4. 事务失败时需要确保决议已经持久化, 否则异步轮询流程会认为协调者尚未决议, 重新发起 Try 并 Confirm
+	if result.Status == TXFailure && !t.persistFailure(ctx, txID, nodes, result) {
+		result.Status = TXHanging
+	}
 
-	successful := true
-	// 3. 同样通过 channel 来进行阻塞, 直到channel 被关闭为止
-	// 3.1 一旦有错误传入通道, for循环执行一次就会调用 cancel 方法熔断其他所有子 goroutine 流程!
-	// 3.2 若是通道为空就会一直阻塞, 直到所有goroutine都执行完毕关闭该通道才会退出for循环继续执行
-	if err := <-errCh; err != nil {
-		// 只要有一笔 try 请求出现问题，其他的都进行终止
-		// 这里关闭 cctx 是怎么实现控制子goroutine的呢???
-		cancel()
-		successful = false
+	// 5. 第二阶段(Confirm或者Cancel)由 prepare 按照第二阶段的执行模式推进
+	return result
+}
+
+// persistFailure 确保事务日志中至少有一个组件的 try 状态为失败, 返回失败的决议是否已经持久化
+//  1. 组件 try 失败时的 TXUpdate 使用被熔断的 ctx, 或者事务日志写入异常时, 事务日志中该组件仍为 hanging 状态
+//  2. 此时使用未被熔断的 ctx 将首个 try 失败的组件标记为失败, 异步轮询流程据此 cancel 而非重新发起 Try
+//  3. 标记同样失败时事务的成败无法确定, 交由异步轮询流程决议
+//  4. ctx 携带事务的截止时间, 截止时间已过时事务日志中存在 hanging 组件的事务必然被判定为失败, 无需再标记
+func (t *TXManager) persistFailure(ctx context.Context, txID string, nodes map[string]*tryNode, result *TXResult) bool {
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return true
+	}
+
+	var failed *ComponentResult
+	for _, componentResult := range result.Components {
+		if componentResult.TryStatus != TryFailure {
+			continue
+		}
+		if nodes[componentResult.ComponentID].persisted {
+			return true
+		}
+		if failed == nil {
+			failed = componentResult
+		}
 	}
+	if failed == nil {
+		return false
+	}
+
+	if err := t.txStore.TXUpdate(ctx, txID, failed.ComponentID, false); err != nil {
+		t.logger(ctx).Errorw("persist tx failure failed", log.KeyComponentID, failed.ComponentID, "err", err)
+		return false
+	}
+	return true
+}
+
+// try 执行单个组件的 Try 流程并将执行结果写入 componentResult, 返回 try 是否成功
+func (t *TXManager) try(ctx context.Context, txID string, componentEntity *ComponentEntity, nodes map[string]*tryNode, componentResult *ComponentResult) bool {
+	// 1. 等待所依赖的组件 try 结束, 被依赖的组件 try 失败时事务注定失败, 当前组件无需再执行 try
+	if err := waitDependencies(ctx, nodes, componentEntity.DependsOn); err != nil {
+		componentResult.Err = err
+		return false
+	}
+
+	// 2. 按照组件的调用配置执行 Try 操作
+	req := &component.TCCReq{ComponentID: componentEntity.ID(), TXID: txID, Data: componentEntity.Request}
+	resp, err := t.invoke(ctx, PhaseTry, req, componentEntity.Component.Try)
+	t.emit(ctx, &Event{Type: EventComponentTried, TXID: txID, Mode: TXModeTCC, ComponentID: componentEntity.ID(), Phase: PhaseTry, Request: componentEntity.Request, ACK: acked(resp, err), Err: err})
+	// 3. try 报错或者拒绝，对应的 cancel 操作会放在 advanceProgressByTXID 流程处理
+	if err != nil || !resp.ACK {
+		t.logger(ctx).Errorw("tx try failed", log.KeyComponentID, componentEntity.ID(), "err", err)
+		componentResult.TryStatus = TryFailure
+		if componentResult.Err = err; err == nil {
+			componentResult.Err = ErrTryRejected
+		}
+		// 3.1 对对应的事务进行更新
+		if _err := t.txStore.TXUpdate(ctx, txID, componentEntity.ID(), false); _err != nil {
+			t.logger(ctx).Errorw("tx updated failed", log.KeyComponentID, componentEntity.ID(), "err", _err)
+		} else {
+			nodes[componentEntity.ID()].persisted = true
+		}
+		return false
+	}
+
+	// 4. try 请求成功，但是请求结果更新到事务日志失败时，也需要视为处理失败
+	// 事务日志中该组件仍为 hanging 状态, 由 twoPhaseCommit 通过 persistFailure 将其标记为失败
+	if err = t.txStore.TXUpdate(ctx, txID, componentEntity.ID(), true); err != nil {
+		t.logger(ctx).Errorw("tx updated failed", log.KeyComponentID, componentEntity.ID(), "err", err)
+		componentResult.TryStatus = TryFailure
+		componentResult.Err = err
+		return false
+	}
+
+	componentResult.TryStatus = TrySucceesful
+	return true
+}
 
-	// 4. 根据事务ID推进当前事务异步执行第二阶段(Confirm或者Cancel)
-	// 之所以是异步，是因为实际上在第一阶段 try 的响应结果尘埃落定时，对应事务的成败已经有了定论
-	// 第二阶段能够容忍异步执行的原因在于，执行失败时，还有轮询任务进行兜底
-	go t.advanceProgressByTXID(txID)
-	return successful, nil
+// logger 返回附加了 ctx 中携带字段(事务 id、组件 id 等)的日志实现
+func (t *TXManager) logger(ctx context.Context) log.StructuredLogger {
+	return log.ContextLogger(ctx, t.opts.Logger)
 }
 
 // 并发执行，只要中间某次出现了失败，直接终止流程进行 cancel
@@ -348,24 +785,39 @@ func (t *TXManager) getComponents(ctx context.Context, reqs ...*RequestEntity) (
 	}
 
 	// 2. 校验其合法性
-	// 2.1 根据 TCC 组件事务ID列表 componentIDs 获得TCC 组件列表
-	components, err := t.registryCenter.getComponents(componentIDs...)
+	// 2.1 推断事务的执行模式, Saga 组件需要从 Saga 组件注册表中获取
+	mode, err := t.registryCenter.getMode(componentIDs...)
 	if err != nil {
 		return nil, err
 	}
-	// 2.2 校验当前获得的 TCC 组件列表和 TX Manager 事务协调器中的 TCC 组件列表长度是否一致
-	if len(componentIDs) != len(components) {
-		return nil, errors.New("invalid componentIDs ")
-	}
 
-	// 3. 拼接 TCC 组件实体得到一个TCC 组件实体列表
-	entities := make(ComponentEntities, 0, len(components))
-	for _, component := range components {
-		entities = append(entities, &ComponentEntity{
-			Request:   idToReq[component.ID()].Request,
-			Component: component,
-		})
+	var entities ComponentEntities
+	if mode == TXModeSaga {
+		if entities, err = t.getSagaComponents(idToReq, componentIDs); err != nil {
+			return nil, err
+		}
+	} else {
+		// 2.2 根据 TCC 组件事务ID列表 componentIDs 获得TCC 组件列表
+		components, err := t.registryCenter.getComponents(componentIDs...)
+		if err != nil {
+			return nil, err
+		}
+		// 2.3 校验当前获得的 TCC 组件列表和 TX Manager 事务协调器中的 TCC 组件列表长度是否一致
+		if len(componentIDs) != len(components) {
+			return nil, errors.New("invalid componentIDs ")
+		}
+
+		// 3. 拼接 TCC 组件实体得到一个TCC 组件实体列表
+		entities = make(ComponentEntities, 0, len(components))
+		for _, component := range components {
+			entities = append(entities, &ComponentEntity{
+				Request:   idToReq[component.ID()].Request,
+				DependsOn: idToReq[component.ID()].DependsOn,
+				Component: component,
+			})
+		}
 	}
 
-	return entities, nil
+	// 4. 按照组件间的依赖关系进行拓扑排序, 事务日志中的组件顺序即为各阶段的执行顺序
+	return entities.sortByDependencies()
 }
@@ -0,0 +1,560 @@
+package txmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/component"
+	"github.com/xiaoxuxiansheng/gotcc/log"
+)
+
+// mockComponent 仅用于单测的 TCC 组件, 根据 ack 决定是否接受 Try 请求
+type mockComponent struct {
+	id  string
+	ack bool
+}
+
+func (m *mockComponent) ID() string {
+	return m.id
+}
+
+func (m *mockComponent) Try(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+	if !m.ack {
+		return nil, errors.New("try failed")
+	}
+	return &component.TCCResp{ComponentID: m.id, TXID: req.TXID, ACK: true}, nil
+}
+
+func (m *mockComponent) Confirm(ctx context.Context, txID string) (*component.TCCResp, error) {
+	return &component.TCCResp{ComponentID: m.id, TXID: txID, ACK: true}, nil
+}
+
+func (m *mockComponent) Cancel(ctx context.Context, txID string) (*component.TCCResp, error) {
+	return &component.TCCResp{ComponentID: m.id, TXID: txID, ACK: true}, nil
+}
+
+// rejectComponent 拒绝所有 try 请求的 TCC 组件
+type rejectComponent struct {
+	mockComponent
+}
+
+func (r *rejectComponent) Try(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+	return &component.TCCResp{ComponentID: r.id, TXID: req.TXID, ACK: false}, nil
+}
+
+// Test_Execute Execute 返回事务 id、事务状态以及各组件 try 的执行结果
+func Test_Execute(t *testing.T) {
+	tests := []struct {
+		name       string
+		reqs       []*RequestEntity
+		wantStatus TXStatus
+		want       map[string]ComponentTryStatus
+		wantErr    map[string]error
+	}{
+		{
+			name:       "successful",
+			reqs:       []*RequestEntity{{ComponentID: "ack1"}, {ComponentID: "ack2"}},
+			wantStatus: TXSuccessful,
+			want:       map[string]ComponentTryStatus{"ack1": TrySucceesful, "ack2": TrySucceesful},
+		},
+		{
+			name:       "rejected",
+			reqs:       []*RequestEntity{{ComponentID: "ack1"}, {ComponentID: "reject"}},
+			wantStatus: TXFailure,
+			want:       map[string]ComponentTryStatus{"ack1": TrySucceesful, "reject": TryFailure},
+			wantErr:    map[string]error{"reject": ErrTryRejected},
+		},
+		{
+			// 被依赖的组件 try 失败, 依赖方的 try 未被执行, 结果保持 hanging
+			name:       "hanging",
+			reqs:       []*RequestEntity{{ComponentID: "reject"}, {ComponentID: "ack1", DependsOn: []string{"reject"}}},
+			wantStatus: TXFailure,
+			want:       map[string]ComponentTryStatus{"reject": TryFailure, "ack1": TryHanging},
+			wantErr:    map[string]error{"reject": ErrTryRejected},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txStore := NewMemTXStore()
+			txManager := NewTXManager(txStore, WithMonitorTick(time.Hour))
+			defer txManager.Stop()
+			for _, c := range []component.TCCComponent{
+				&mockComponent{id: "ack1", ack: true},
+				&mockComponent{id: "ack2", ack: true},
+				&rejectComponent{mockComponent{id: "reject"}},
+			} {
+				if err := txManager.Register(c); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result, err := txManager.Execute(context.Background(), tt.reqs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.TXID == "" {
+				t.Error("empty txID")
+			}
+			if result.Status != tt.wantStatus {
+				t.Errorf("tx status: %s, want: %s", result.Status, tt.wantStatus)
+			}
+			if (result.Err() == nil) != result.Successful() {
+				t.Errorf("result err: %v, successful: %t", result.Err(), result.Successful())
+			}
+			if len(result.Components) != len(tt.want) {
+				t.Fatalf("component results: %d, want: %d", len(result.Components), len(tt.want))
+			}
+			for _, componentResult := range result.Components {
+				if want := tt.want[componentResult.ComponentID]; componentResult.TryStatus != want {
+					t.Errorf("component: %s try status: %s, want: %s", componentResult.ComponentID, componentResult.TryStatus, want)
+				}
+				wantErr, ok := tt.wantErr[componentResult.ComponentID]
+				switch {
+				case ok && !errors.Is(componentResult.Err, wantErr):
+					t.Errorf("component: %s err: %v, want: %v", componentResult.ComponentID, componentResult.Err, wantErr)
+				case !ok && componentResult.TryStatus == TrySucceesful && componentResult.Err != nil:
+					t.Errorf("component: %s unexpected err: %v", componentResult.ComponentID, componentResult.Err)
+				case componentResult.TryStatus == TryHanging && componentResult.Err == nil:
+					// try 未被执行的原因可能是依赖方失败, 也可能是事务已被熔断
+					t.Errorf("component: %s skipped without err", componentResult.ComponentID)
+				}
+			}
+
+			// 事务 id 可以用于后续查询事务
+			if _, err = txStore.GetTX(context.Background(), result.TXID); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// Test_TwoPhaseCommitGoroutineLeak 多个组件同时 try 失败时, 不能遗留阻塞的 goroutine
+func Test_TwoPhaseCommitGoroutineLeak(t *testing.T) {
+	txManager := NewTXManager(NewMemTXStore(), WithMonitorTick(time.Hour))
+	defer txManager.Stop()
+
+	reqs := make([]*RequestEntity, 0, 5)
+	for i := 0; i < 5; i++ {
+		componentID := fmt.Sprintf("component%d", i)
+		if err := txManager.Register(&mockComponent{id: componentID}); err != nil {
+			t.Fatal(err)
+		}
+		reqs = append(reqs, &RequestEntity{ComponentID: componentID})
+	}
+
+	// 预热一笔事务, 排除日志模块等常驻 goroutine 的干扰
+	if _, err := txManager.Execute(context.Background(), reqs...); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 200; i++ {
+		result, err := txManager.Execute(context.Background(), reqs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Successful() {
+			t.Fatal("tx should fail")
+		}
+		for _, componentResult := range result.Components {
+			if componentResult.TryStatus != TryFailure || componentResult.Err == nil {
+				t.Fatalf("unexpected component result: %+v", componentResult)
+			}
+		}
+	}
+
+	// 异步推进第二阶段的 goroutine 结束后, goroutine 数量应当回落
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutine leaked, before: %d, after: %d", before, runtime.NumGoroutine())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Test_AdvanceProgressDeadline 异步轮询以事务日志中持久化的截止时间判断事务是否超时, 而非当前节点的 Timeout 配置
+func Test_AdvanceProgressDeadline(t *testing.T) {
+	tests := []struct {
+		name      string
+		txTimeout time.Duration
+		timeout   time.Duration
+		tried     bool
+		want      TXStatus
+	}{
+		{name: "expired", txTimeout: time.Millisecond, timeout: time.Hour, want: TXFailure},
+		{name: "not expired", txTimeout: time.Hour, timeout: time.Millisecond, want: TXSuccessful},
+		// 所有组件 try 成功后事务已经决议为成功, 截止时间过后仍然需要 confirm 而不是 cancel
+		{name: "expired after tried", txTimeout: time.Millisecond, timeout: time.Hour, tried: true, want: TXSuccessful},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txStore := NewMemTXStore()
+			txManager := NewTXManager(txStore, WithTimeout(tt.timeout), WithMonitorTick(time.Hour))
+			defer txManager.Stop()
+
+			c := &mockComponent{id: "component", ack: true}
+			if err := txManager.Register(c); err != nil {
+				t.Fatal(err)
+			}
+
+			// 模拟创建事务后尚未执行 try(或者 try 成功后尚未执行第二阶段)便宕机的节点
+			txID, err := txStore.CreateTX(context.Background(), NewTransaction(ComponentEntities{{Component: c}}, tt.txTimeout))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.tried {
+				if err = txStore.TXUpdate(context.Background(), txID, c.ID(), true); err != nil {
+					t.Fatal(err)
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+
+			if err = txManager.advanceProgressByTXID(txManager.ctx, txID); err != nil {
+				t.Fatal(err)
+			}
+			tx, err := txStore.GetTX(context.Background(), txID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tx.Status != tt.want {
+				t.Errorf("tx status: %s, want: %s", tx.Status, tt.want)
+			}
+		})
+	}
+}
+
+// Test_SyncSecondPhase 同步执行第二阶段时, 返回之前事务的最终状态已经提交
+func Test_SyncSecondPhase(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		txOpts []TXOption
+	}{
+		{name: "manager", opts: []Option{WithSecondPhase(SecondPhaseSync)}},
+		{name: "per call", txOpts: []TXOption{WithTXSecondPhase(SecondPhaseSync)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txStore := NewMemTXStore()
+			txManager := NewTXManager(txStore, append(tt.opts, WithMonitorTick(time.Hour))...)
+			defer txManager.Stop()
+
+			c := &mockComponent{id: "component", ack: true}
+			if err := txManager.Register(c); err != nil {
+				t.Fatal(err)
+			}
+			result, err := txManager.ExecuteWithOptions(context.Background(), []*RequestEntity{{ComponentID: c.ID()}}, tt.txOpts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Finalized || result.FinalizeErr != nil {
+				t.Errorf("finalized: %t, err: %v", result.Finalized, result.FinalizeErr)
+			}
+			tx, err := txStore.GetTX(context.Background(), result.TXID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tx.Status != TXSuccessful {
+				t.Errorf("tx status: %s, want: %s", tx.Status, TXSuccessful)
+			}
+		})
+	}
+}
+
+// Test_SyncSecondPhaseDeadline 第二阶段未能在截止时间之前完成时, 返回 ErrNotFinalized 并交由异步轮询流程兜底
+func Test_SyncSecondPhaseDeadline(t *testing.T) {
+	txStore := NewMemTXStore()
+	txManager := NewTXManager(txStore, WithMonitorTick(time.Hour), WithSecondPhase(SecondPhaseSync))
+	defer txManager.Stop()
+
+	c := &hangingComponent{mockComponent: mockComponent{id: "hanging", ack: true}}
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	success, err := txManager.TransactionWithOptions(context.Background(), []*RequestEntity{{ComponentID: c.ID()}}, WithTXTimeout(100*time.Millisecond))
+	if !success || !errors.Is(err, ErrNotFinalized) {
+		t.Errorf("success: %t, err: %v, want: true, %v", success, err, ErrNotFinalized)
+	}
+	if cost := time.Since(start); cost > time.Second {
+		t.Errorf("transaction cost: %v, want about: %v", cost, 100*time.Millisecond)
+	}
+
+	txs, _, err := txStore.GetHangingTXs(context.Background(), HangingQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 1 {
+		t.Errorf("hanging txs: %d, want: 1", len(txs))
+	}
+}
+
+// Test_SyncSecondPhaseNotFinalized 第二阶段被组件拒绝时, 事务的最终状态未提交, 不能视为已完成
+func Test_SyncSecondPhaseNotFinalized(t *testing.T) {
+	txStore := NewMemTXStore()
+	txManager := NewTXManager(txStore, WithMonitorTick(time.Hour), WithSecondPhase(SecondPhaseSync), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+
+	c := &nackConfirmComponent{mockComponent: mockComponent{id: "component", ack: true}}
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	result, err := txManager.Execute(context.Background(), &RequestEntity{ComponentID: c.ID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Successful() || result.Finalized || result.FinalizeErr == nil {
+		t.Errorf("tx status: %s, finalized: %t, err: %v", result.Status, result.Finalized, result.FinalizeErr)
+	}
+	if tx, _ := txStore.GetTX(context.Background(), result.TXID); tx.Status != TXHanging {
+		t.Errorf("tx status: %s, want: %s", tx.Status, TXHanging)
+	}
+
+	success, err := txManager.Transaction(context.Background(), &RequestEntity{ComponentID: c.ID()})
+	if !success || !errors.Is(err, ErrNotFinalized) {
+		t.Errorf("success: %t, err: %v, want: true, %v", success, err, ErrNotFinalized)
+	}
+}
+
+// replayComponent 记录 try 请求参数以及第二阶段调用的 TCC 组件
+type replayComponent struct {
+	mockComponent
+	mux    sync.Mutex
+	tries  []map[string]interface{}
+	phases []Phase
+}
+
+func (r *replayComponent) Try(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+	r.mux.Lock()
+	r.tries = append(r.tries, req.Data)
+	r.mux.Unlock()
+	return r.mockComponent.Try(ctx, req)
+}
+
+func (r *replayComponent) Confirm(ctx context.Context, txID string) (*component.TCCResp, error) {
+	r.mux.Lock()
+	r.phases = append(r.phases, PhaseConfirm)
+	r.mux.Unlock()
+	return r.mockComponent.Confirm(ctx, txID)
+}
+
+func (r *replayComponent) Cancel(ctx context.Context, txID string) (*component.TCCResp, error) {
+	r.mux.Lock()
+	r.phases = append(r.phases, PhaseCancel)
+	r.mux.Unlock()
+	return r.mockComponent.Cancel(ctx, txID)
+}
+
+func (r *replayComponent) called() ([]map[string]interface{}, []Phase) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]map[string]interface{}(nil), r.tries...), append([]Phase(nil), r.phases...)
+}
+
+// Test_TryPayloadPersisted 各组件的 try 请求参数以及依赖关系随事务日志持久化
+func Test_TryPayloadPersisted(t *testing.T) {
+	txStore := NewMemTXStore()
+	txManager := NewTXManager(txStore, WithMonitorTick(time.Hour))
+	defer txManager.Stop()
+	for _, id := range []string{"a", "b"} {
+		if err := txManager.Register(&mockComponent{id: id, ack: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := txManager.Execute(context.Background(),
+		&RequestEntity{ComponentID: "a", Request: map[string]interface{}{"biz_id": "1"}},
+		&RequestEntity{ComponentID: "b", Request: map[string]interface{}{"biz_id": "2"}, DependsOn: []string{"a"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := txStore.GetTX(context.Background(), result.TXID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": "1", "b": "2"}
+	for _, component := range tx.Components {
+		if bizID := component.Request["biz_id"]; bizID != want[component.ComponentID] {
+			t.Errorf("component: %s request biz_id: %v, want: %s", component.ComponentID, bizID, want[component.ComponentID])
+		}
+		if component.ComponentID == "b" && (len(component.DependsOn) != 1 || component.DependsOn[0] != "a") {
+			t.Errorf("component: b depends on: %v, want: [a]", component.DependsOn)
+		}
+	}
+}
+
+// Test_RetryHangingTries 创建事务的节点在 try 阶段宕机后, 任意节点基于持久化的请求参数补发 try 并推进第二阶段
+func Test_RetryHangingTries(t *testing.T) {
+	txStore := NewMemTXStore()
+	txManager := NewTXManager(txStore, WithMonitorTick(time.Hour))
+	defer txManager.Stop()
+
+	c := &replayComponent{mockComponent: mockComponent{id: "component", ack: true}}
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	txID, err := txStore.CreateTX(context.Background(), NewTransaction(ComponentEntities{
+		{Component: c, Request: map[string]interface{}{"biz_id": "1"}},
+	}, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = txManager.advanceProgressByTXID(txManager.ctx, txID); err != nil {
+		t.Fatal(err)
+	}
+	tries, phases := c.called()
+	if len(tries) != 1 || tries[0]["biz_id"] != "1" {
+		t.Errorf("replayed tries: %v, want one with biz_id: 1", tries)
+	}
+	if len(phases) != 1 || phases[0] != PhaseConfirm {
+		t.Errorf("second phase: %v, want: [%s]", phases, PhaseConfirm)
+	}
+	if tx, _ := txStore.GetTX(context.Background(), txID); tx.Status != TXSuccessful {
+		t.Errorf("tx status: %s, want: %s", tx.Status, TXSuccessful)
+	}
+}
+
+// ownedComponent 首次 Try 在 release 关闭之前阻塞并最终拒绝请求, 模拟仍在执行第一阶段的节点; 补发的 Try 均被接受
+type ownedComponent struct {
+	replayComponent
+	once    sync.Once
+	started chan struct{}
+	release chan struct{}
+}
+
+func (o *ownedComponent) Try(ctx context.Context, req *component.TCCReq) (*component.TCCResp, error) {
+	var first bool
+	o.once.Do(func() { first = true })
+	resp, err := o.replayComponent.Try(ctx, req)
+	if !first {
+		return resp, err
+	}
+	close(o.started)
+	<-o.release
+	return &component.TCCResp{ComponentID: o.id, TXID: req.TXID, ACK: false}, nil
+}
+
+// Test_RetryHangingTriesOwned 创建事务的节点仍在执行第一阶段时, 异步轮询流程不能补发 Try, 否则补发的结果会覆盖原始的决议
+func Test_RetryHangingTriesOwned(t *testing.T) {
+	txStore := NewMemTXStore()
+	// 所有权租约的有效期短于 Try 的耗时, 依赖创建事务的节点在第一阶段期间续约
+	txManager := NewTXManager(txStore, WithMonitorTick(time.Hour), WithOwnerTTL(30*time.Millisecond), WithSecondPhase(SecondPhaseSync), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+
+	c := &ownedComponent{
+		replayComponent: replayComponent{mockComponent: mockComponent{id: "component", ack: true}},
+		started:         make(chan struct{}),
+		release:         make(chan struct{}),
+	}
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan *TXResult, 1)
+	go func() {
+		result, _ := txManager.Execute(context.Background(), &RequestEntity{ComponentID: "component", Request: map[string]interface{}{"biz_id": "1"}})
+		results <- result
+	}()
+	<-c.started
+	time.Sleep(100 * time.Millisecond)
+
+	// 异步轮询流程在第一阶段执行期间推进同一笔事务
+	if err := txManager.advanceProgressByTXID(txManager.ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	close(c.release)
+
+	result := <-results
+	if result == nil || result.Status != TXFailure {
+		t.Fatalf("tx result: %+v, want status: %s", result, TXFailure)
+	}
+	if tries, phases := c.called(); len(tries) != 1 || len(phases) != 1 || phases[0] != PhaseCancel {
+		t.Errorf("tries: %v, second phase: %v, want the original try followed by cancel", tries, phases)
+	}
+	if tx, _ := txStore.GetTX(context.Background(), result.TXID); tx.Status != TXFailure {
+		t.Errorf("tx status: %s, want: %s", tx.Status, TXFailure)
+	}
+}
+
+// acceptUpdateFailedTXStore 记录 try 成功结果时写入失败的事务日志存储模块, failAll 为 true 时所有 try 结果均写入失败
+type acceptUpdateFailedTXStore struct {
+	*MemTXStore
+	failAll bool
+}
+
+func (a *acceptUpdateFailedTXStore) TXUpdate(ctx context.Context, txID string, componentID string, accept bool) error {
+	if accept || a.failAll {
+		return errors.New("tx store unavailable")
+	}
+	return a.MemTXStore.TXUpdate(ctx, txID, componentID, accept)
+}
+
+// Test_TryUpdateFailedNotReplayed try 成功但结果写入事务日志失败时, 事务判定为失败, 异步轮询流程不能重新发起 try 并 confirm
+func Test_TryUpdateFailedNotReplayed(t *testing.T) {
+	txStore := &acceptUpdateFailedTXStore{MemTXStore: NewMemTXStore()}
+	txManager := NewTXManager(txStore, WithMonitorTick(time.Hour), WithSecondPhase(SecondPhaseSync), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+
+	c := &replayComponent{mockComponent: mockComponent{id: "component", ack: true}}
+	if err := txManager.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	result, err := txManager.Execute(context.Background(), &RequestEntity{ComponentID: c.ID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != TXFailure {
+		t.Fatalf("tx status: %s, want: %s", result.Status, TXFailure)
+	}
+
+	// 异步轮询流程再次推进同一笔事务
+	if err = txManager.advanceProgressByTXID(txManager.ctx, result.TXID); err != nil {
+		t.Fatal(err)
+	}
+	tries, phases := c.called()
+	if len(tries) != 1 {
+		t.Errorf("tries: %d, want: 1", len(tries))
+	}
+	for _, phase := range phases {
+		if phase != PhaseCancel {
+			t.Errorf("second phase: %v, want cancel only", phases)
+			break
+		}
+	}
+	if tx, _ := txStore.GetTX(context.Background(), result.TXID); tx.Status != TXFailure {
+		t.Errorf("tx status: %s, want: %s", tx.Status, TXFailure)
+	}
+}
+
+// Test_TryUpdateFailedUndecided 失败的决议同样无法写入事务日志时, 事务的成败交由异步轮询流程决议
+func Test_TryUpdateFailedUndecided(t *testing.T) {
+	txStore := &acceptUpdateFailedTXStore{MemTXStore: NewMemTXStore(), failAll: true}
+	txManager := NewTXManager(txStore, WithMonitorTick(time.Hour), WithLogger(log.NewNopLogger()))
+	defer txManager.Stop()
+
+	if err := txManager.Register(&mockComponent{id: "component", ack: true}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := txManager.Execute(context.Background(), &RequestEntity{ComponentID: "component"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != TXHanging || result.Successful() {
+		t.Errorf("tx status: %s, want: %s", result.Status, TXHanging)
+	}
+
+	// Transaction 不能将未决议的事务报告为失败
+	if success, err := txManager.Transaction(context.Background(), &RequestEntity{ComponentID: "component"}); success || !errors.Is(err, ErrUndecided) {
+		t.Errorf("tx success: %t, err: %v, want: %v", success, err, ErrUndecided)
+	}
+}
@@ -3,8 +3,6 @@ package txmanager
 import (
 	"context"
 	"time"
-
-	"github.com/xiaoxuxiansheng/gotcc/component"
 )
 
 // TXStore 事务日志存储模块
@@ -20,17 +18,45 @@ import (
 type TXStore interface {
 	// CreateTX 创建一条事务明细记录
 	// 注意: 这里返回的 txID 是在整个分布式架构下全局唯一的事务ID!
-	CreateTX(ctx context.Context, components ...component.TCCComponent) (txID string, err error)
+	// tx 中每个组件的 Request 请求参数、DependsOn 依赖关系、事务的执行模式 Mode、截止时间 Deadline、所有权租约的到期时间 OwnerExpireAt 以及 TraceParent 需要一并持久化, 并在 GetTX、GetHangingTXs 中原样返回
+	// 事务中组件的顺序同样需要保持不变, Saga 模式依赖该顺序执行正向操作和补偿操作
+	CreateTX(ctx context.Context, tx *Transaction) (txID string, err error)
 	// TXUpdate 更新事务进度：实际更新的是每个组件的 try 请求响应结果
+	// 组件的 try 结果只能写入一次: try 状态已经不是 hanging 时需要拒绝更新并返回 ErrTryDecided, 校验与写入需要在同一个原子操作中完成,
+	// 避免补发的 Try 与创建事务的节点并发时, 后写入的结果覆盖已经据此决议的结果
+	// 异步轮询流程的写操作在 ctx 中携带 leader 租约的 fencing token, TXUpdate、TXSubmit、TXRetry、TXDeadLetter
+	// 需要通过 CheckFencingToken 校验, 拒绝过期 token 的写入并返回 ErrStaleToken, 同时持久化事务已经接受过的最大 token
 	TXUpdate(ctx context.Context, txID string, componentID string, accept bool) error
+	// TXRenewOwner 续约创建事务的节点对事务第一阶段的所有权租约, 将 OwnerExpireAt 更新为 expireAt, 事务已经处于终态时返回错误
+	// 租约到期之前异步轮询流程不会补发 Try, 避免补发的 Try 与创建事务的节点仍在执行的第一阶段并发
+	TXRenewOwner(ctx context.Context, txID string, expireAt time.Time) error
 	// TXSubmit 提交事务的最终状态, 标识事务执行结果为成功或失败
+	// dead_letter 状态的事务经过人工介入(TXManager.Retry、ForceConfirm、ForceCancel)后同样通过 TXSubmit 提交最终状态
 	TXSubmit(ctx context.Context, txID string, success bool) error
-	// GetHangingTXs 获取到所有未完成的事务
-	GetHangingTXs(ctx context.Context) ([]*Transaction, error)
+	// TXRetry 记录推进事务第二阶段失败的结果: attempts 为累计失败次数, nextRetryAt 为下一次重试的时间, lastErr 为本次失败的原因
+	// 三者需要持久化并在 GetTX、GetHangingTXs 中原样返回, 事务已经处于终态时返回错误
+	TXRetry(ctx context.Context, txID string, attempts int, nextRetryAt time.Time, lastErr string) error
+	// TXDeadLetter 将 hanging 状态的事务置为 dead_letter 终态并记录最后一次失败的原因, 事务已经处于 successful、failure 状态时返回错误
+	// 对 dead_letter 状态的事务调用时仅更新失败原因
+	TXDeadLetter(ctx context.Context, txID string, lastErr string) error
+	// TXForce 持久化运维人员对 hanging 或者 dead_letter 状态的事务的强制决议以及原因, 二者需要在 GetTX、GetHangingTXs 中原样返回
+	// 事务已经处于 successful、failure 终态, 或者已经被强制决议为不同的结果时返回错误; 重复提交相同的决议视为成功, 保留最初的原因
+	TXForce(ctx context.Context, txID string, success bool, reason string) error
+	// GetHangingTXs 分页获取未完成的事务
+	// 1. query 为查询条件, 开启分片恢复模式时仅返回属于指定分片的事务, 事务所属的分片需要按照 ShardOf 计算, 可以通过 query.Match 在内存中过滤
+	// 2. 事务按照创建时间由早到晚排列, 异步轮询流程据此优先推进最早创建的事务
+	// 3. 单页最多返回 query.Limit 笔事务, next 为下一页的游标, 没有更多事务时 next 为空.
+	//    游标的格式由实现自行决定, 建议基于排序键(例如自增主键)实现, 翻页期间新增或者完成的事务不能导致其余事务被跳过
+	GetHangingTXs(ctx context.Context, query HangingQuery) (txs []*Transaction, next string, err error)
 	// GetTX 获取指定的一笔事务
 	GetTX(ctx context.Context, txID string) (*Transaction, error)
 	// Lock 锁住整个 TXStore 模块（要求为分布式锁） -> 多个 TX Manager 节点同时执行异步轮询操作在修改事务状态的时候可能会发生冲突
-	Lock(ctx context.Context, expireDuration time.Duration) error
-	// Unlock 解锁TXStore 模块
-	Unlock(ctx context.Context) error
+	// 未通过 WithElector 注入选主模块时, 异步轮询流程基于 Lock、RenewLock、Unlock 选主
+	// 加锁成功时返回 fencing token, token 需要由存储侧的计数器生成, 每次加锁成功时单调递增, 并作为锁的持有者标识
+	Lock(ctx context.Context, expireDuration time.Duration) (token int64, err error)
+	// RenewLock 续约: 原子地校验锁仍由 token 持有, 并将锁的过期时间重置为 expireDuration 之后. 锁已经过期或者被其他节点取得时返回错误
+	// 续约可能与加锁来自不同的 goroutine, 不能依赖 goroutine 标识锁的持有者
+	RenewLock(ctx context.Context, token int64, expireDuration time.Duration) error
+	// Unlock 解锁TXStore 模块, 仅当锁仍由 token 持有时解锁
+	Unlock(ctx context.Context, token int64) error
 }
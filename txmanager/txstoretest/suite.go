@@ -0,0 +1,766 @@
+// Package txstoretest 提供 TXStore 实现的一致性测试套件
+// 自定义 TXStore 的使用方可以在单测中调用 RunTXStoreSuite, 校验其实现是否满足 TX Manager 对事务日志存储模块的约定
+package txstoretest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaoxuxiansheng/gotcc/txmanager"
+)
+
+// Factory 每次调用都需要返回一个全新的、与其他实例数据隔离的 TXStore
+type Factory func() txmanager.TXStore
+
+// RunTXStoreSuite 针对 TXStore 的实现运行一致性测试
+// 1. 覆盖 TXStore 接口中的所有方法
+// 2. 覆盖并发更新组件状态、锁的互斥性、锁的过期以及事务状态的流转等边界场景
+func RunTXStoreSuite(t *testing.T, factory Factory) {
+	cases := []struct {
+		name string
+		run  func(t *testing.T, store txmanager.TXStore)
+	}{
+		{"CreateTX", testCreateTX},
+		{"GetTXNotExisted", testGetTXNotExisted},
+		{"TXUpdate", testTXUpdate},
+		{"TXUpdateUnknown", testTXUpdateUnknown},
+		{"TXUpdateDecided", testTXUpdateDecided},
+		{"TXUpdateConcurrent", testTXUpdateConcurrent},
+		{"TXRenewOwner", testTXRenewOwner},
+		{"TXSubmit", testTXSubmit},
+		{"TXRetry", testTXRetry},
+		{"TXDeadLetter", testTXDeadLetter},
+		{"TXForce", testTXForce},
+		{"GetHangingTXs", testGetHangingTXs},
+		{"GetHangingTXsByShards", testGetHangingTXsByShards},
+		{"GetHangingTXsPaged", testGetHangingTXsPaged},
+		{"FencingToken", testFencingToken},
+		{"LockExclusive", testLockExclusive},
+		{"LockConcurrent", testLockConcurrent},
+		{"LockExpire", testLockExpire},
+		{"LockRenew", testLockRenew},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			c.run(t, factory())
+		})
+	}
+}
+
+// newTransaction 构造一笔包含 n 个组件的待创建事务
+func newTransaction(n int) *txmanager.Transaction {
+	components := make([]*txmanager.ComponentTryEntity, 0, n)
+	for i := 0; i < n; i++ {
+		entity := &txmanager.ComponentTryEntity{
+			ComponentID: fmt.Sprintf("component%d", i),
+			TryStatus:   txmanager.TryHanging,
+			Request: map[string]interface{}{
+				"biz_id": fmt.Sprintf("biz%d", i),
+			},
+		}
+		// 每个组件依赖前一个组件, 用于校验依赖关系的持久化
+		if i > 0 {
+			entity.DependsOn = []string{fmt.Sprintf("component%d", i-1)}
+		}
+		components = append(components, entity)
+	}
+	now := time.Now()
+	return &txmanager.Transaction{
+		Components: components,
+		Status:     txmanager.TXHanging,
+		Mode:       txmanager.TXModeTCC,
+		CreatedAt:  now,
+		Deadline:   now.Add(time.Minute),
+		// 创建事务的节点持有的所有权租约
+		OwnerExpireAt: now.Add(30 * time.Second),
+		// 链路追踪开启时由 TXManager 写入的根 span 上下文
+		TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}
+}
+
+func mustCreateTX(t *testing.T, store txmanager.TXStore, tx *txmanager.Transaction) string {
+	t.Helper()
+	txID, err := store.CreateTX(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("create tx failed, err: %v", err)
+	}
+	if txID == "" {
+		t.Fatal("create tx returned empty tx id")
+	}
+	return txID
+}
+
+func mustGetTX(t *testing.T, store txmanager.TXStore, txID string) *txmanager.Transaction {
+	t.Helper()
+	tx, err := store.GetTX(context.Background(), txID)
+	if err != nil {
+		t.Fatalf("get tx: %s failed, err: %v", txID, err)
+	}
+	if tx.TXID != txID {
+		t.Fatalf("get tx: %s returned tx id: %s", txID, tx.TXID)
+	}
+	return tx
+}
+
+func tryStatusOf(t *testing.T, tx *txmanager.Transaction, componentID string) txmanager.ComponentTryStatus {
+	t.Helper()
+	for _, component := range tx.Components {
+		if component.ComponentID == componentID {
+			return component.TryStatus
+		}
+	}
+	t.Fatalf("component: %s not found in tx: %s", componentID, tx.TXID)
+	return ""
+}
+
+// testCreateTX 创建事务后, 组件顺序、请求参数、依赖关系、执行模式、截止时间、所有权租约的到期时间以及 TraceParent 都需要原样返回
+func testCreateTX(t *testing.T, store txmanager.TXStore) {
+	want := newTransaction(3)
+	txID := mustCreateTX(t, store, want)
+	if otherID := mustCreateTX(t, store, newTransaction(1)); otherID == txID {
+		t.Fatalf("create tx returned duplicated tx id: %s", txID)
+	}
+
+	got := mustGetTX(t, store, txID)
+	if got.Status != txmanager.TXHanging {
+		t.Errorf("new tx status: %s, want: %s", got.Status, txmanager.TXHanging)
+	}
+	if got.Mode != want.Mode {
+		t.Errorf("new tx mode: %s, want: %s", got.Mode, want.Mode)
+	}
+	if got.CreatedAt.IsZero() {
+		t.Error("new tx created at is zero")
+	}
+	// 截止时间允许存储引擎存在秒级的精度损失
+	if diff := got.Deadline.Sub(want.Deadline); diff < -time.Second || diff > time.Second {
+		t.Errorf("new tx deadline: %v, want: %v", got.Deadline, want.Deadline)
+	}
+	if diff := got.OwnerExpireAt.Sub(want.OwnerExpireAt); diff < -time.Second || diff > time.Second {
+		t.Errorf("new tx owner expire at: %v, want: %v", got.OwnerExpireAt, want.OwnerExpireAt)
+	}
+	if got.TraceParent != want.TraceParent {
+		t.Errorf("new tx trace parent: %s, want: %s", got.TraceParent, want.TraceParent)
+	}
+	if len(got.Components) != len(want.Components) {
+		t.Fatalf("new tx components: %d, want: %d", len(got.Components), len(want.Components))
+	}
+	for i, component := range got.Components {
+		if component.ComponentID != want.Components[i].ComponentID {
+			t.Errorf("component %d id: %s, want: %s", i, component.ComponentID, want.Components[i].ComponentID)
+		}
+		if component.TryStatus != txmanager.TryHanging {
+			t.Errorf("component: %s try status: %s, want: %s", component.ComponentID, component.TryStatus, txmanager.TryHanging)
+		}
+		if !reflect.DeepEqual(component.Request, want.Components[i].Request) {
+			t.Errorf("component: %s request: %v, want: %v", component.ComponentID, component.Request, want.Components[i].Request)
+		}
+		if len(component.DependsOn) != len(want.Components[i].DependsOn) ||
+			(len(component.DependsOn) > 0 && !reflect.DeepEqual(component.DependsOn, want.Components[i].DependsOn)) {
+			t.Errorf("component: %s depends on: %v, want: %v", component.ComponentID, component.DependsOn, want.Components[i].DependsOn)
+		}
+	}
+}
+
+// testGetTXNotExisted 获取不存在的事务需要返回错误
+func testGetTXNotExisted(t *testing.T, store txmanager.TXStore) {
+	if _, err := store.GetTX(context.Background(), "not_existed_tx"); err == nil {
+		t.Error("get not existed tx should fail")
+	}
+}
+
+// testTXUpdate 组件的 try 结果需要准确地更新到对应组件上, 且不影响其他组件
+func testTXUpdate(t *testing.T, store txmanager.TXStore) {
+	ctx := context.Background()
+	txID := mustCreateTX(t, store, newTransaction(3))
+
+	if err := store.TXUpdate(ctx, txID, "component0", true); err != nil {
+		t.Fatalf("tx update failed, err: %v", err)
+	}
+	if err := store.TXUpdate(ctx, txID, "component1", false); err != nil {
+		t.Fatalf("tx update failed, err: %v", err)
+	}
+
+	tx := mustGetTX(t, store, txID)
+	if status := tryStatusOf(t, tx, "component0"); status != txmanager.TrySucceesful {
+		t.Errorf("component0 try status: %s, want: %s", status, txmanager.TrySucceesful)
+	}
+	if status := tryStatusOf(t, tx, "component1"); status != txmanager.TryFailure {
+		t.Errorf("component1 try status: %s, want: %s", status, txmanager.TryFailure)
+	}
+	if status := tryStatusOf(t, tx, "component2"); status != txmanager.TryHanging {
+		t.Errorf("component2 try status: %s, want: %s", status, txmanager.TryHanging)
+	}
+	// 更新组件状态不能改变事务本身的状态
+	if tx.Status != txmanager.TXHanging {
+		t.Errorf("tx status: %s, want: %s", tx.Status, txmanager.TXHanging)
+	}
+}
+
+// testTXUpdateUnknown 更新不存在的事务或者事务中不存在的组件需要返回错误
+func testTXUpdateUnknown(t *testing.T, store txmanager.TXStore) {
+	ctx := context.Background()
+	txID := mustCreateTX(t, store, newTransaction(1))
+
+	if err := store.TXUpdate(ctx, "not_existed_tx", "component0", true); err == nil {
+		t.Error("update not existed tx should fail")
+	}
+	if err := store.TXUpdate(ctx, txID, "not_existed_component", true); err == nil {
+		t.Error("update not existed component should fail")
+	}
+}
+
+// testTXUpdateDecided 组件的 try 结果已经写入后不能被再次覆盖, 需要返回 ErrTryDecided
+func testTXUpdateDecided(t *testing.T, store txmanager.TXStore) {
+	ctx := context.Background()
+	txID := mustCreateTX(t, store, newTransaction(2))
+
+	if err := store.TXUpdate(ctx, txID, "component0", false); err != nil {
+		t.Fatalf("tx update failed, err: %v", err)
+	}
+	if err := store.TXUpdate(ctx, txID, "component1", true); err != nil {
+		t.Fatalf("tx update failed, err: %v", err)
+	}
+	if err := store.TXUpdate(ctx, txID, "component0", true); !errors.Is(err, txmanager.ErrTryDecided) {
+		t.Errorf("overwrite failed try err: %v, want: %v", err, txmanager.ErrTryDecided)
+	}
+	if err := store.TXUpdate(ctx, txID, "component1", false); !errors.Is(err, txmanager.ErrTryDecided) {
+		t.Errorf("overwrite successful try err: %v, want: %v", err, txmanager.ErrTryDecided)
+	}
+
+	tx := mustGetTX(t, store, txID)
+	if status := tryStatusOf(t, tx, "component0"); status != txmanager.TryFailure {
+		t.Errorf("component0 try status: %s, want: %s", status, txmanager.TryFailure)
+	}
+	if status := tryStatusOf(t, tx, "component1"); status != txmanager.TrySucceesful {
+		t.Errorf("component1 try status: %s, want: %s", status, txmanager.TrySucceesful)
+	}
+}
+
+// testTXUpdateConcurrent 并发更新同一笔事务中的不同组件时, 不能丢失任何一次更新
+func testTXUpdateConcurrent(t *testing.T, store txmanager.TXStore) {
+	const n = 16
+	ctx := context.Background()
+	txID := mustCreateTX(t, store, newTransaction(n))
+
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = store.TXUpdate(ctx, txID, fmt.Sprintf("component%d", i), i%2 == 0)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("component%d update failed, err: %v", i, err)
+		}
+	}
+
+	tx := mustGetTX(t, store, txID)
+	for i := 0; i < n; i++ {
+		want := txmanager.TryFailure
+		if i%2 == 0 {
+			want = txmanager.TrySucceesful
+		}
+		if status := tryStatusOf(t, tx, fmt.Sprintf("component%d", i)); status != want {
+			t.Errorf("component%d try status: %s, want: %s", i, status, want)
+		}
+	}
+}
+
+// testTXRenewOwner 续约后所有权租约的到期时间需要在 GetTX、GetHangingTXs 中返回, 事务完成后不能再续约
+func testTXRenewOwner(t *testing.T, store txmanager.TXStore) {
+	ctx := context.Background()
+	txID := mustCreateTX(t, store, newTransaction(1))
+	expireAt := time.Now().Add(time.Minute)
+	if err := store.TXRenewOwner(ctx, txID, expireAt); err != nil {
+		t.Fatalf("tx renew owner failed, err: %v", err)
+	}
+
+	check := func(tx *txmanager.Transaction) {
+		// 存储层的时间精度可能只到秒
+		if diff := tx.OwnerExpireAt.Sub(expireAt); diff > time.Second || diff < -time.Second {
+			t.Errorf("tx owner expire at: %v, want: %v", tx.OwnerExpireAt, expireAt)
+		}
+	}
+	check(mustGetTX(t, store, txID))
+	txs, _, err := store.GetHangingTXs(ctx, txmanager.HangingQuery{})
+	if err != nil {
+		t.Fatalf("get hanging txs failed, err: %v", err)
+	}
+	var found bool
+	for _, tx := range txs {
+		if tx.TXID == txID {
+			found = true
+			check(tx)
+		}
+	}
+	if !found {
+		t.Errorf("hanging tx: %s not returned", txID)
+	}
+
+	if err = store.TXSubmit(ctx, txID, false); err != nil {
+		t.Fatalf("tx submit failed, err: %v", err)
+	}
+	if err = store.TXRenewOwner(ctx, txID, expireAt); err == nil {
+		t.Error("renew owner of finished tx should fail")
+	}
+}
+
+// testTXSubmit 提交事务的最终状态, 组件的 try 状态需要保持不变
+func testTXSubmit(t *testing.T, store txmanager.TXStore) {
+	ctx := context.Background()
+	successTXID := mustCreateTX(t, store, newTransaction(1))
+	failureTXID := mustCreateTX(t, store, newTransaction(1))
+
+	if err := store.TXUpdate(ctx, successTXID, "component0", true); err != nil {
+		t.Fatalf("tx update failed, err: %v", err)
+	}
+	if err := store.TXSubmit(ctx, successTXID, true); err != nil {
+		t.Fatalf("tx submit failed, err: %v", err)
+	}
+	if err := store.TXSubmit(ctx, failureTXID, false); err != nil {
+		t.Fatalf("tx submit failed, err: %v", err)
+	}
+
+	if tx := mustGetTX(t, store, successTXID); tx.Status != txmanager.TXSuccessful {
+		t.Errorf("tx status: %s, want: %s", tx.Status, txmanager.TXSuccessful)
+	} else if status := tryStatusOf(t, tx, "component0"); status != txmanager.TrySucceesful {
+		t.Errorf("component0 try status: %s, want: %s", status, txmanager.TrySucceesful)
+	}
+	if tx := mustGetTX(t, store, failureTXID); tx.Status != txmanager.TXFailure {
+		t.Errorf("tx status: %s, want: %s", tx.Status, txmanager.TXFailure)
+	}
+
+	if err := store.TXSubmit(ctx, "not_existed_tx", true); err == nil {
+		t.Error("submit not existed tx should fail")
+	}
+}
+
+// testTXRetry 失败次数、下一次重试时间以及失败原因需要持久化, 终态的事务不能再记录重试
+func testTXRetry(t *testing.T, store txmanager.TXStore) {
+	ctx := context.Background()
+	txID := mustCreateTX(t, store, newTransaction(1))
+	nextRetryAt := time.Now().Add(time.Minute)
+	if err := store.TXRetry(ctx, txID, 2, nextRetryAt, "confirm failed"); err != nil {
+		t.Fatalf("tx retry failed, err: %v", err)
+	}
+
+	check := func(tx *txmanager.Transaction) {
+		if tx.Attempts != 2 || tx.LastError != "confirm failed" {
+			t.Errorf("tx attempts: %d last error: %q, want: 2 %q", tx.Attempts, tx.LastError, "confirm failed")
+		}
+		// 存储层的时间精度可能只到秒
+		if diff := tx.NextRetryAt.Sub(nextRetryAt); diff > time.Second || diff < -time.Second {
+			t.Errorf("tx next retry at: %v, want: %v", tx.NextRetryAt, nextRetryAt)
+		}
+	}
+	check(mustGetTX(t, store, txID))
+	txs, _, err := store.GetHangingTXs(ctx, txmanager.HangingQuery{})
+	if err != nil {
+		t.Fatalf("get hanging txs failed, err: %v", err)
+	}
+	var found bool
+	for _, tx := range txs {
+		if tx.TXID == txID {
+			found = true
+			check(tx)
+		}
+	}
+	if !found {
+		t.Errorf("hanging tx: %s not returned", txID)
+	}
+
+	if err = store.TXSubmit(ctx, txID, true); err != nil {
+		t.Fatalf("tx submit failed, err: %v", err)
+	}
+	if err = store.TXRetry(ctx, txID, 3, nextRetryAt, "confirm failed"); err == nil {
+		t.Error("retry finished tx should fail")
+	}
+}
+
+// testTXDeadLetter dead_letter 状态的事务不再被 GetHangingTXs 返回, 人工介入后可以提交最终状态
+func testTXDeadLetter(t *testing.T, store txmanager.TXStore) {
+	ctx := context.Background()
+	txID := mustCreateTX(t, store, newTransaction(1))
+	if err := store.TXDeadLetter(ctx, txID, "cancel rejected"); err != nil {
+		t.Fatalf("tx dead letter failed, err: %v", err)
+	}
+	if tx := mustGetTX(t, store, txID); tx.Status != txmanager.TXDeadLetter || tx.LastError != "cancel rejected" {
+		t.Errorf("tx status: %s last error: %q, want: %s %q", tx.Status, tx.LastError, txmanager.TXDeadLetter, "cancel rejected")
+	}
+
+	txs, _, err := store.GetHangingTXs(ctx, txmanager.HangingQuery{})
+	if err != nil {
+		t.Fatalf("get hanging txs failed, err: %v", err)
+	}
+	for _, tx := range txs {
+		if tx.TXID == txID {
+			t.Errorf("dead letter tx: %s should not be returned", txID)
+		}
+	}
+	// 人工介入后可以提交最终状态
+	if err = store.TXDeadLetter(ctx, txID, "cancel rejected again"); err != nil {
+		t.Fatalf("tx dead letter again failed, err: %v", err)
+	}
+	if tx := mustGetTX(t, store, txID); tx.LastError != "cancel rejected again" {
+		t.Errorf("tx last error: %q, want: %q", tx.LastError, "cancel rejected again")
+	}
+	if err = store.TXSubmit(ctx, txID, false); err != nil {
+		t.Fatalf("submit dead letter tx failed, err: %v", err)
+	}
+	if tx := mustGetTX(t, store, txID); tx.Status != txmanager.TXFailure {
+		t.Errorf("tx status: %s, want: %s", tx.Status, txmanager.TXFailure)
+	}
+
+	submittedTXID := mustCreateTX(t, store, newTransaction(1))
+	if err = store.TXSubmit(ctx, submittedTXID, false); err != nil {
+		t.Fatalf("tx submit failed, err: %v", err)
+	}
+	if err = store.TXDeadLetter(ctx, submittedTXID, "cancel rejected"); err == nil {
+		t.Error("dead letter finished tx should fail")
+	}
+}
+
+// testTXForce 强制决议以及原因需要持久化并在 GetTX、GetHangingTXs 中返回, 已经强制决议的事务不能改为不同的结果
+func testTXForce(t *testing.T, store txmanager.TXStore) {
+	ctx := context.Background()
+	txID := mustCreateTX(t, store, newTransaction(1))
+	if err := store.TXForce(ctx, txID, true, "try applied manually"); err != nil {
+		t.Fatalf("tx force failed, err: %v", err)
+	}
+	if tx := mustGetTX(t, store, txID); tx.Status != txmanager.TXHanging || tx.ForcedStatus != txmanager.TXSuccessful || tx.ForceReason != "try applied manually" {
+		t.Errorf("tx status: %s forced: %s reason: %q", tx.Status, tx.ForcedStatus, tx.ForceReason)
+	}
+	txs, _, err := store.GetHangingTXs(ctx, txmanager.HangingQuery{})
+	if err != nil {
+		t.Fatalf("get hanging txs failed, err: %v", err)
+	}
+	var found bool
+	for _, tx := range txs {
+		if tx.TXID == txID {
+			found = tx.ForcedStatus == txmanager.TXSuccessful && tx.ForceReason == "try applied manually"
+		}
+	}
+	if !found {
+		t.Errorf("forced tx: %s not returned with its decision", txID)
+	}
+
+	// 重复提交相同的决议视为成功并保留最初的原因, 不同的决议返回错误
+	if err = store.TXForce(ctx, txID, true, "again"); err != nil {
+		t.Fatalf("tx force again failed, err: %v", err)
+	}
+	if err = store.TXForce(ctx, txID, false, "rollback"); err == nil {
+		t.Error("force tx to another decision should fail")
+	}
+	if tx := mustGetTX(t, store, txID); tx.ForcedStatus != txmanager.TXSuccessful || tx.ForceReason != "try applied manually" {
+		t.Errorf("tx forced: %s reason: %q, want: %s %q", tx.ForcedStatus, tx.ForceReason, txmanager.TXSuccessful, "try applied manually")
+	}
+
+	// dead_letter 状态的事务可以强制决议, 终态的事务不可以
+	deadTXID := mustCreateTX(t, store, newTransaction(1))
+	if err = store.TXDeadLetter(ctx, deadTXID, "cancel rejected"); err != nil {
+		t.Fatalf("tx dead letter failed, err: %v", err)
+	}
+	if err = store.TXForce(ctx, deadTXID, false, "rollback"); err != nil {
+		t.Fatalf("force dead letter tx failed, err: %v", err)
+	}
+	if err = store.TXSubmit(ctx, txID, true); err != nil {
+		t.Fatalf("tx submit failed, err: %v", err)
+	}
+	if err = store.TXForce(ctx, txID, true, "again"); err == nil {
+		t.Error("force finished tx should fail")
+	}
+}
+
+// testGetHangingTXs 需要依据事务本身的状态而不是组件的 try 状态进行过滤
+func testGetHangingTXs(t *testing.T, store txmanager.TXStore) {
+	ctx := context.Background()
+	// 1. 组件 try 全部成功但尚未提交的事务, 仍然处于 hanging 状态
+	triedTXID := mustCreateTX(t, store, newTransaction(1))
+	if err := store.TXUpdate(ctx, triedTXID, "component0", true); err != nil {
+		t.Fatalf("tx update failed, err: %v", err)
+	}
+	// 2. 组件 try 失败但尚未提交的事务, 同样处于 hanging 状态
+	rejectedTXID := mustCreateTX(t, store, newTransaction(1))
+	if err := store.TXUpdate(ctx, rejectedTXID, "component0", false); err != nil {
+		t.Fatalf("tx update failed, err: %v", err)
+	}
+	// 3. 尚未执行 try 的事务
+	newTXID := mustCreateTX(t, store, newTransaction(1))
+	// 4. 已经提交的事务不能再被返回
+	successTXID := mustCreateTX(t, store, newTransaction(1))
+	if err := store.TXSubmit(ctx, successTXID, true); err != nil {
+		t.Fatalf("tx submit failed, err: %v", err)
+	}
+	failureTXID := mustCreateTX(t, store, newTransaction(1))
+	if err := store.TXSubmit(ctx, failureTXID, false); err != nil {
+		t.Fatalf("tx submit failed, err: %v", err)
+	}
+
+	txs, _, err := store.GetHangingTXs(ctx, txmanager.HangingQuery{})
+	if err != nil {
+		t.Fatalf("get hanging txs failed, err: %v", err)
+	}
+
+	got := make(map[string]*txmanager.Transaction, len(txs))
+	for _, tx := range txs {
+		got[tx.TXID] = tx
+	}
+	for _, txID := range []string{triedTXID, rejectedTXID, newTXID} {
+		tx, ok := got[txID]
+		if !ok {
+			t.Errorf("hanging tx: %s not returned", txID)
+			continue
+		}
+		if tx.Status != txmanager.TXHanging {
+			t.Errorf("hanging tx: %s status: %s", txID, tx.Status)
+		}
+		if len(tx.Components) != 1 || tx.CreatedAt.IsZero() {
+			t.Errorf("hanging tx: %s returned incomplete record", txID)
+		}
+	}
+	for _, txID := range []string{successTXID, failureTXID} {
+		if _, ok := got[txID]; ok {
+			t.Errorf("finished tx: %s should not be returned", txID)
+		}
+	}
+	if tx, ok := got[rejectedTXID]; ok && len(tx.Components) == 1 && tx.Components[0].TryStatus != txmanager.TryFailure {
+		t.Errorf("hanging tx: %s component try status: %s, want: %s", rejectedTXID, tx.Components[0].TryStatus, txmanager.TryFailure)
+	}
+}
+
+// testGetHangingTXsByShards 按照分片查询时, 只返回属于指定分片的事务, 且各分片的查询结果互不重叠
+func testGetHangingTXsByShards(t *testing.T, store txmanager.TXStore) {
+	ctx := context.Background()
+	const totalShards = 4
+	created := make(map[string]bool)
+	for i := 0; i < 16; i++ {
+		created[mustCreateTX(t, store, newTransaction(1))] = true
+	}
+
+	seen := make(map[string]int)
+	for shard := 0; shard < totalShards; shard++ {
+		txs, _, err := store.GetHangingTXs(ctx, txmanager.HangingQuery{TotalShards: totalShards, Shards: []int{shard}})
+		if err != nil {
+			t.Fatalf("get hanging txs failed, err: %v", err)
+		}
+		for _, tx := range txs {
+			if got := txmanager.ShardOf(tx.TXID, totalShards); got != shard {
+				t.Errorf("tx: %s shard: %d, want: %d", tx.TXID, got, shard)
+			}
+			seen[tx.TXID]++
+		}
+	}
+	for txID := range created {
+		if seen[txID] != 1 {
+			t.Errorf("tx: %s returned %d times, want: 1", txID, seen[txID])
+		}
+	}
+}
+
+// testGetHangingTXsPaged 分页查询按照创建时间由早到晚返回全部 hanging 事务, 翻页期间完成的事务不影响其余事务的返回
+func testGetHangingTXsPaged(t *testing.T, store txmanager.TXStore) {
+	ctx := context.Background()
+	txIDs := make([]string, 0, 8)
+	for i := 0; i < 8; i++ {
+		txIDs = append(txIDs, mustCreateTX(t, store, newTransaction(1)))
+	}
+
+	var (
+		got   []*txmanager.Transaction
+		query = txmanager.HangingQuery{Limit: 3}
+	)
+	for page := 0; ; page++ {
+		if page > len(txIDs) {
+			t.Fatal("pagination not terminated")
+		}
+		txs, next, err := store.GetHangingTXs(ctx, query)
+		if err != nil {
+			t.Fatalf("get hanging txs failed, err: %v", err)
+		}
+		if len(txs) > query.Limit {
+			t.Errorf("page size: %d, want at most: %d", len(txs), query.Limit)
+		}
+		got = append(got, txs...)
+		// 第一页之后提交最后一笔事务, 该事务不能再被返回
+		// 同时提交游标所在的事务, 游标对应的事务已经完成时仍然能够从其之后继续翻页
+		if page == 0 {
+			if err = store.TXSubmit(ctx, txIDs[len(txIDs)-1], true); err != nil {
+				t.Fatalf("tx submit failed, err: %v", err)
+			}
+			if err = store.TXSubmit(ctx, txs[len(txs)-1].TXID, false); err != nil {
+				t.Fatalf("tx submit failed, err: %v", err)
+			}
+		}
+		if next == "" {
+			break
+		}
+		query.Cursor = next
+	}
+
+	if len(got) != len(txIDs)-1 {
+		t.Fatalf("hanging txs: %d, want: %d", len(got), len(txIDs)-1)
+	}
+	seen := make(map[string]bool, len(got))
+	for i, tx := range got {
+		if seen[tx.TXID] {
+			t.Errorf("tx: %s returned more than once", tx.TXID)
+		}
+		seen[tx.TXID] = true
+		if i > 0 && tx.CreatedAt.Before(got[i-1].CreatedAt) {
+			t.Errorf("tx: %s created before previous tx: %s", tx.TXID, got[i-1].TXID)
+		}
+	}
+	for _, txID := range txIDs[:len(txIDs)-1] {
+		if !seen[txID] {
+			t.Errorf("hanging tx: %s not returned", txID)
+		}
+	}
+}
+
+// testFencingToken 事务接受过新 leader 的写入后, 需要拒绝携带更小 fencing token 的写操作, 未携带 token 的写操作不受影响
+func testFencingToken(t *testing.T, store txmanager.TXStore) {
+	ctx := context.Background()
+	txID := mustCreateTX(t, store, newTransaction(2))
+	oldLeader, newLeader := txmanager.WithFencingToken(ctx, 1), txmanager.WithFencingToken(ctx, 2)
+
+	if err := store.TXUpdate(oldLeader, txID, "component0", true); err != nil {
+		t.Fatalf("tx update with token 1 failed, err: %v", err)
+	}
+	if err := store.TXUpdate(newLeader, txID, "component1", true); err != nil {
+		t.Fatalf("tx update with token 2 failed, err: %v", err)
+	}
+	if err := store.TXUpdate(oldLeader, txID, "component1", false); !errors.Is(err, txmanager.ErrStaleToken) {
+		t.Errorf("tx update with stale token err: %v, want: %v", err, txmanager.ErrStaleToken)
+	}
+	if status := tryStatusOf(t, mustGetTX(t, store, txID), "component1"); status != txmanager.TrySucceesful {
+		t.Errorf("component1 try status: %s, want: %s", status, txmanager.TrySucceesful)
+	}
+	if err := store.TXRetry(oldLeader, txID, 1, time.Now(), "stale"); !errors.Is(err, txmanager.ErrStaleToken) {
+		t.Errorf("tx retry with stale token err: %v, want: %v", err, txmanager.ErrStaleToken)
+	}
+	if err := store.TXSubmit(oldLeader, txID, false); !errors.Is(err, txmanager.ErrStaleToken) {
+		t.Errorf("tx submit with stale token err: %v, want: %v", err, txmanager.ErrStaleToken)
+	}
+	if got := mustGetTX(t, store, txID); got.Status != txmanager.TXHanging {
+		t.Errorf("tx status after stale submit: %s, want: %s", got.Status, txmanager.TXHanging)
+	}
+
+	if err := store.TXSubmit(ctx, txID, true); err != nil {
+		t.Fatalf("tx submit without token failed, err: %v", err)
+	}
+}
+
+// testLockExclusive 锁被持有期间不能被再次获取, 解锁后可以重新获取, 每次加锁返回的 fencing token 单调递增
+func testLockExclusive(t *testing.T, store txmanager.TXStore) {
+	ctx := context.Background()
+	token, err := store.Lock(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatalf("lock failed, err: %v", err)
+	}
+	if _, err = store.Lock(ctx, 10*time.Second); err == nil {
+		t.Fatal("lock should be exclusive")
+	}
+	// 非持有者解锁不生效
+	if err = store.Unlock(ctx, token+1); err == nil {
+		if _, err = store.Lock(ctx, 10*time.Second); err == nil {
+			t.Fatal("unlock with other token should not release the lock")
+		}
+	}
+	if err = store.Unlock(ctx, token); err != nil {
+		t.Fatalf("unlock failed, err: %v", err)
+	}
+	next, err := store.Lock(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatalf("lock after unlock failed, err: %v", err)
+	}
+	if next <= token {
+		t.Errorf("fencing token: %d, want greater than: %d", next, token)
+	}
+	_ = store.Unlock(ctx, next)
+}
+
+// testLockConcurrent 并发取锁时, 有且仅有一个调用方能够成功
+func testLockConcurrent(t *testing.T, store txmanager.TXStore) {
+	const n = 16
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	var mux sync.Mutex
+	var acquired []int64
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := store.Lock(ctx, 10*time.Second); err == nil {
+				mux.Lock()
+				acquired = append(acquired, token)
+				mux.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(acquired) != 1 {
+		t.Fatalf("lock acquired %d times concurrently, want: 1", len(acquired))
+	}
+	_ = store.Unlock(ctx, acquired[0])
+}
+
+// testLockExpire 锁到达过期时间后需要自动释放, 过期的锁不能再续约
+// 过期时长取 1s, 兼容以秒为粒度设置过期时间的分布式锁实现
+func testLockExpire(t *testing.T, store txmanager.TXStore) {
+	ctx := context.Background()
+	token, err := store.Lock(ctx, time.Second)
+	if err != nil {
+		t.Fatalf("lock failed, err: %v", err)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	next, err := store.Lock(ctx, time.Second)
+	if err != nil {
+		t.Fatalf("lock after expired failed, err: %v", err)
+	}
+	if err = store.RenewLock(ctx, token, time.Second); err == nil {
+		t.Error("renew expired lock should fail")
+	}
+	_ = store.Unlock(ctx, next)
+}
+
+// testLockRenew 续约后锁的过期时间顺延, 续约可以在与加锁不同的 goroutine 中执行
+func testLockRenew(t *testing.T, store txmanager.TXStore) {
+	ctx := context.Background()
+	token, err := store.Lock(ctx, time.Second)
+	if err != nil {
+		t.Fatalf("lock failed, err: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		time.Sleep(600 * time.Millisecond)
+		renewed := make(chan error, 1)
+		go func() {
+			renewed <- store.RenewLock(ctx, token, time.Second)
+		}()
+		if err = <-renewed; err != nil {
+			t.Fatalf("renew lock failed, err: %v", err)
+		}
+	}
+	// 此时距离加锁已经超过初始的过期时长, 锁仍然被持有
+	if _, err = store.Lock(ctx, time.Second); err == nil {
+		t.Fatal("renewed lock should still be held")
+	}
+	if err = store.Unlock(ctx, token); err != nil {
+		t.Fatalf("unlock failed, err: %v", err)
+	}
+}